@@ -0,0 +1,178 @@
+package treetop
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is an element of an Accept request header, see RFC 7231 section 5.3.2
+type mediaRange struct {
+	mediaType string
+	subType   string
+	quality   float64
+}
+
+// specificity of the range, exact match ranks higher than wildcards
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.mediaType == "*":
+		return 0
+	case mr.subType == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matches returns true if the range includes the media type
+func (mr mediaRange) matches(mediaType, subType string) bool {
+	return (mr.mediaType == "*" || mr.mediaType == mediaType) &&
+		(mr.subType == "*" || mr.subType == subType)
+}
+
+// acceptHeader is a parsed list of media ranges from an Accept header
+type acceptHeader struct {
+	empty  bool
+	ranges []mediaRange
+}
+
+// parseAccept will parse the media ranges of an Accept header value along with the
+// quality values. Elements that cannot be parsed are ignored.
+func parseAccept(header string) acceptHeader {
+	accept := acceptHeader{
+		empty: strings.TrimSpace(header) == "",
+	}
+	for _, element := range splitAcceptElements(header) {
+		parts := strings.Split(element, ";")
+		rng := strings.ToLower(strings.TrimSpace(parts[0]))
+		if rng == "" {
+			continue
+		}
+		if rng == "*" {
+			// not strictly valid but sent by some clients
+			rng = "*/*"
+		}
+		slash := strings.IndexByte(rng, '/')
+		if slash < 1 || slash == len(rng)-1 {
+			continue
+		}
+		mr := mediaRange{
+			mediaType: rng[:slash],
+			subType:   rng[slash+1:],
+			quality:   1,
+		}
+		if mr.mediaType == "*" && mr.subType != "*" {
+			continue
+		}
+		valid := true
+		for _, param := range parts[1:] {
+			name, value, ok := cutParam(param)
+			if !ok || name != "q" {
+				// media type parameters and accept extensions are not considered
+				continue
+			}
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			mr.quality = q
+			// parameters following the weight are accept extensions
+			break
+		}
+		if valid {
+			accept.ranges = append(accept.ranges, mr)
+		}
+	}
+	return accept
+}
+
+// splitAcceptElements will split an Accept header value into media range elements.
+//
+// For compatibility with older clients, media ranges separated by a semicolon
+// are also supported, for example "text/html; application/x.treetop-html-template+xml".
+func splitAcceptElements(header string) []string {
+	var elements []string
+	for _, element := range strings.Split(header, ",") {
+		parts := strings.Split(element, ";")
+		start := 0
+		for i := 1; i < len(parts); i++ {
+			if strings.Contains(parts[i], "/") && !strings.Contains(parts[i], "=") {
+				elements = append(elements, strings.Join(parts[start:i], ";"))
+				start = i
+			}
+		}
+		elements = append(elements, strings.Join(parts[start:], ";"))
+	}
+	return elements
+}
+
+// cutParam splits a media type parameter into a lower case name and value
+func cutParam(param string) (name, value string, ok bool) {
+	eq := strings.IndexByte(param, '=')
+	if eq < 0 {
+		return "", "", false
+	}
+	name = strings.ToLower(strings.TrimSpace(param[:eq]))
+	value = strings.Trim(strings.TrimSpace(param[eq+1:]), `"`)
+	return name, value, name != ""
+}
+
+// quality returns the weight given to a media type by the most specific matching range.
+// If the header was empty, all media types are acceptable.
+func (a acceptHeader) quality(mediaType string) float64 {
+	if a.empty {
+		return 1
+	}
+	typ, sub := splitMediaType(mediaType)
+	best := -1
+	var q float64
+	for _, mr := range a.ranges {
+		if mr.matches(typ, sub) && mr.specificity() > best {
+			best = mr.specificity()
+			q = mr.quality
+		}
+	}
+	return q
+}
+
+// explicitQuality returns the weight given to a media type by a range that names
+// the media type exactly, wildcards are not considered.
+func (a acceptHeader) explicitQuality(mediaType string) (float64, bool) {
+	typ, sub := splitMediaType(mediaType)
+	for _, mr := range a.ranges {
+		if mr.mediaType == typ && mr.subType == sub {
+			return mr.quality, true
+		}
+	}
+	return 0, false
+}
+
+// prefers returns true if the media type is named explicitly in the header and
+// it is acceptable with a quality no less than a HTML document.
+//
+// Wildcards do not count since treetop content types must be requested explicitly,
+// where a client accepts both a treetop content type and HTML with the same weight
+// the treetop content type is preferred.
+func (a acceptHeader) prefers(mediaType string) bool {
+	q, ok := a.explicitQuality(mediaType)
+	if !ok || q == 0 {
+		return false
+	}
+	return q >= a.quality("text/html")
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	mediaType = strings.ToLower(mediaType)
+	if slash := strings.IndexByte(mediaType, '/'); slash > -1 {
+		return mediaType[:slash], mediaType[slash+1:]
+	}
+	return mediaType, ""
+}
+
+// acceptsMediaType is a predicate that checks if a request prefers the specified
+// media type over a HTML document
+func acceptsMediaType(req *http.Request, mediaType string) bool {
+	return parseAccept(strings.Join(req.Header.Values("Accept"), ",")).prefers(mediaType)
+}
@@ -0,0 +1,100 @@
+package treetop
+
+import (
+	"testing"
+)
+
+func Test_acceptHeader_quality(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		mediaType string
+		want      float64
+	}{
+		{
+			name:      "empty header accepts anything",
+			header:    "",
+			mediaType: "text/html",
+			want:      1,
+		},
+		{
+			name:      "exact match",
+			header:    "text/html;q=0.7",
+			mediaType: "text/html",
+			want:      0.7,
+		},
+		{
+			name:      "no match",
+			header:    "text/plain",
+			mediaType: "text/html",
+			want:      0,
+		},
+		{
+			name:      "wildcard",
+			header:    "text/plain, */*;q=0.1",
+			mediaType: "text/html",
+			want:      0.1,
+		},
+		{
+			name:      "most specific range takes precedence",
+			header:    "text/*;q=0.3, text/html;q=0.7, */*;q=0.5",
+			mediaType: "text/html",
+			want:      0.7,
+		},
+		{
+			name:      "sub type wildcard",
+			header:    "text/*;q=0.3, */*;q=0.5",
+			mediaType: "text/html",
+			want:      0.3,
+		},
+		{
+			name:      "media type parameters and accept extensions",
+			header:    "text/html;level=1;q=0.4;ext=1",
+			mediaType: "text/html",
+			want:      0.4,
+		},
+		{
+			name:      "invalid quality is ignored",
+			header:    "text/html;q=abc, */*;q=0.2",
+			mediaType: "text/html",
+			want:      0.2,
+		},
+		{
+			name:      "whitespace and case",
+			header:    "  TEXT/HTML ; Q=0.5 ",
+			mediaType: "text/html",
+			want:      0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAccept(tt.header).quality(tt.mediaType); got != tt.want {
+				t.Errorf("acceptHeader.quality() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_acceptHeader_prefers(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "empty", header: "", want: false},
+		{name: "any", header: "*/*", want: false},
+		{name: "application wildcard", header: "application/*", want: false},
+		{name: "explicit", header: TemplateContentType, want: true},
+		{name: "equal weight", header: TemplateContentType + ";q=0.5, text/html;q=0.5", want: true},
+		{name: "lower weight", header: TemplateContentType + ";q=0.4, text/html;q=0.5", want: false},
+		{name: "html wildcard weight", header: TemplateContentType + ";q=0.4, */*;q=0.1", want: true},
+		{name: "not acceptable", header: TemplateContentType + ";q=0", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAccept(tt.header).prefers(TemplateContentType); got != tt.want {
+				t.Errorf("acceptHeader.prefers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package treetop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// name of the template function used to supply error data to an error template
+const viewErrorFuncName = "treetopViewError"
+
+// ViewError is the data supplied to the error template of a view when the view failed to render
+type ViewError struct {
+	View *View
+	Err  error
+	// Data is the template data for the view that failed
+	Data interface{}
+}
+
+// Error implements the error interface
+func (ve *ViewError) Error() string {
+	if ve == nil || ve.Err == nil {
+		return "nil"
+	}
+	return ve.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (ve *ViewError) Unwrap() error {
+	if ve == nil {
+		return nil
+	}
+	return ve.Err
+}
+
+// errorTemplateName is the name given to the error template of a view
+func errorTemplateName(v *View) string {
+	return v.Defines + ":error"
+}
+
+// errorBoundaries are used to render a view template again following an execution error, substituting
+// the error template of the nearest view in the hierarchy for the block that failed.
+type errorBoundaries struct {
+	// source is a copy of the view template that has not been executed
+	source *template.Template
+	// owners maps template names to the view which defined them
+	owners map[string]*View
+	// parents maps each view in the hierarchy to the view it is embedded within
+	parents map[*View]*View
+}
+
+// boundary finds the nearest view with an error template that is responsible for the failed template
+func (eb *errorBoundaries) boundary(name string, failed map[*View]*ViewError) *View {
+	// html/template derives templates for escaping contexts using a name suffix
+	if i := strings.Index(name, "$htmltemplate"); i > -1 {
+		name = name[:i]
+	}
+	for v := eb.owners[name]; v != nil; v = eb.parents[v] {
+		if _, ok := failed[v]; !ok && v.ErrorTemplate != "" {
+			return v
+		}
+	}
+	return nil
+}
+
+// viewFailures records the views of a response with a handler that panicked, the error template
+// of each view will be rendered in place of the view template
+type viewFailures struct {
+	mu    sync.Mutex
+	views map[*View]*ViewError
+}
+
+// add records the failure of a view handler
+func (vf *viewFailures) add(verr *ViewError) {
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+	if vf.views == nil {
+		vf.views = make(map[*View]*ViewError)
+	}
+	vf.views[verr.View] = verr
+}
+
+// owned returns the failed views which belong to the error boundaries of a template
+func (vf *viewFailures) owned(eb *errorBoundaries) map[*View]*ViewError {
+	failed := make(map[*View]*ViewError)
+	if vf == nil || eb == nil {
+		return failed
+	}
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+	for v, verr := range vf.views {
+		if eb.owners[v.Defines] == v {
+			failed[v] = verr
+		}
+	}
+	return failed
+}
+
+// recoverViewFailure must be deferred by the caller of a view handler function before
+// recoverHandlerPanic. A handler panic is recorded as a failure of the view, unless the
+// response has already been written.
+func (rsp *ResponseWrapper) recoverViewFailure(view *View, data *interface{}) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	hp, ok := r.(*HandlerPanic)
+	if !ok || rsp.hijacked || rsp.Finished() {
+		panic(r)
+	}
+	rsp.failures.add(&ViewError{View: view, Err: hp})
+	*data = nil
+}
+
+// substitute creates a template where the error template replaces each of the failed views
+func (eb *errorBoundaries) substitute(failed map[*View]*ViewError) (*template.Template, error) {
+	t, err := eb.source.Clone()
+	if err != nil {
+		return nil, err
+	}
+	errs := make(map[string]*ViewError, len(failed))
+	for v, verr := range failed {
+		errs[v.Defines] = verr
+	}
+	t.Funcs(template.FuncMap{
+		viewErrorFuncName: func(name string, data interface{}) *ViewError {
+			verr := *errs[name]
+			if sv, ok := data.(*streamedSubView); ok {
+				data = sv.data
+			}
+			if frag, ok := data.(*cachedFragment); ok {
+				data = frag.data
+			}
+			verr.Data = data
+			return &verr
+		},
+	})
+	// cached views must be rendered using the substituted templates
+	bindFragmentFunc(t)
+	for v := range failed {
+		// redefine the view template so that the error template is executed in its place
+		_, err := t.Parse(fmt.Sprintf(
+			`{{ define %q }}{{ template %q %s %q . }}{{ end }}`,
+			v.Defines, errorTemplateName(v), viewErrorFuncName, v.Defines,
+		))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// executeTemplate will execute a view template, writing the output to the buffer. Following
+// a failure, the template is executed again with an error template in place of the nearest
+// view with an error boundary. An error is returned when no error template can be found.
+// The error template is used from the outset for a view with a handler that panicked.
+func (h *TemplateHandler) executeTemplate(resp *ResponseWrapper, req *http.Request, buf *bytes.Buffer, tmpl Template, eb *errorBoundaries, view *View, data interface{}) (err error) {
+	name := view.Defines
+	start := buf.Len()
+	if resp.observer != nil {
+		began := time.Now()
+		defer func() {
+			resp.observeTemplate(req, view, began, buf.Len()-start, err)
+		}()
+	}
+	// views with a handler that panicked are substituted before the template is executed
+	failed := resp.failures.owned(eb)
+	if len(failed) == 0 {
+		err = tmpl.ExecuteTemplate(buf, name, data)
+		if err == nil {
+			resp.fragments.commit()
+			return nil
+		}
+		// fragments rendered before the failure will not be cached
+		resp.fragments.discard()
+		if eb == nil {
+			return err
+		}
+	} else {
+		for v, verr := range failed {
+			h.logResponse(slog.LevelError, "treetop: rendering error template", resp, req, v, verr.Err)
+		}
+		t, subErr := eb.substitute(failed)
+		if subErr != nil {
+			return subErr
+		}
+		err = t.ExecuteTemplate(buf, name, data)
+	}
+	for err != nil {
+		failedName, ok := failedTemplateName(err)
+		if !ok {
+			return err
+		}
+		v := eb.boundary(failedName, failed)
+		if v == nil {
+			return err
+		}
+		h.logResponse(slog.LevelError, "treetop: rendering error template", resp, req, v, err)
+		failed[v] = &ViewError{View: v, Err: err}
+
+		buf.Truncate(start)
+		t, subErr := eb.substitute(failed)
+		if subErr != nil {
+			return err
+		}
+		err = t.ExecuteTemplate(buf, name, data)
+	}
+	resp.fragments.discard()
+	resp.Status(http.StatusInternalServerError)
+	return nil
+}
+
+// failedTemplateName finds the name of the template that caused an execution error. Where a
+// template was executed by a template function, the error of the inner template is used.
+func failedTemplateName(err error) (string, bool) {
+	var execErr texttemplate.ExecError
+	if !errors.As(err, &execErr) {
+		return "", false
+	}
+	for {
+		var inner texttemplate.ExecError
+		if !errors.As(execErr.Err, &inner) {
+			return execErr.Name, true
+		}
+		execErr = inner
+	}
+}
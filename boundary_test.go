@@ -0,0 +1,323 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func setupErrorBoundary() (*View, *View) {
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content":  rsp.HandleSubView("content", req),
+			"Comments": rsp.HandleSubView("comments", req),
+		}
+	})
+	base.NewDefaultSubView("content", "content.html", Constant("Hello"))
+	comments := base.NewDefaultSubView("comments", "comments.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Count": 2,
+			"List":  rsp.HandleSubView("list", req),
+		}
+	})
+	comments.ErrorTemplate = "comments-error.html"
+	comments.NewDefaultSubView("list", "list.html", Constant("not a list"))
+	return base, comments
+}
+
+var errorBoundaryTemplates = map[string]string{
+	"base.html":           `<main>{{ template "content" .Content }}</main><aside>{{ template "comments" .Comments }}</aside>`,
+	"content.html":        `<p id="content">{{ . }}</p>`,
+	"comments.html":       `<div id="comments"><h2>{{ .Count }} comments</h2>{{ template "list" .List }}</div>`,
+	"list.html":           `<ul>{{ range .Items }}<li>{{ . }}</li>{{ end }}</ul>`,
+	"comments-error.html": `<div id="comments">Comments unavailable for {{ .View.Defines }}, {{ .Data.Count }}</div>`,
+}
+
+func TestErrorBoundary_PageRequest(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	exec := NewKeyedStringExecutor(errorBoundaryTemplates)
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	expect := `<main><p id="content">Hello</p></main>` +
+		`<aside><div id="comments">Comments unavailable for comments, 2</div></aside>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestErrorBoundary_StreamPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		status int
+	}{
+		{
+			name:   "page head sent before handlers",
+			base:   errorBoundaryTemplates["base.html"],
+			status: http.StatusOK,
+		},
+		{
+			name:   "no static page head",
+			base:   `{{ if true }}<main>{{ end }}{{ template "content" .Content }}</main><aside>{{ template "comments" .Comments }}</aside>`,
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := make(map[string]string)
+			for name, tmpl := range errorBoundaryTemplates {
+				templates[name] = tmpl
+			}
+			templates["base.html"] = tt.base
+			base, _ := setupErrorBoundary()
+			exec := NewKeyedStringExecutor(templates)
+			th, ok := exec.NewViewHandler(base).(*TemplateHandler)
+			if !ok {
+				t.Fatal("Expecting a *TemplateHandler")
+			}
+			if errs := exec.FlushErrors(); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			th.StreamPage = true
+			rec := httptest.NewRecorder()
+			th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+			if rec.Code != tt.status {
+				t.Errorf("Expecting status %d, got %d", tt.status, rec.Code)
+			}
+			expect := `<main><p id="content">Hello</p></main>` +
+				`<aside><div id="comments">Comments unavailable for comments, 2</div></aside>`
+			if got := sDumpBody(rec); got != expect {
+				t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+			}
+		})
+	}
+}
+
+func TestErrorBoundary_TemplateRequest(t *testing.T) {
+	_, comments := setupErrorBoundary()
+	exec := NewKeyedStringExecutor(errorBoundaryTemplates)
+	handler := exec.NewViewHandler(comments)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	expect := "<template>\n<div id=\"comments\">Comments unavailable for comments, 2</div>\n</template>"
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestErrorBoundary_NoFailure(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	templates := make(map[string]string)
+	for key, value := range errorBoundaryTemplates {
+		templates[key] = value
+	}
+	templates["list.html"] = `<ul><li>{{ . }}</li></ul>`
+	exec := NewKeyedStringExecutor(templates)
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expecting status %d, got %d", http.StatusOK, rec.Code)
+	}
+	expect := `<main><p id="content">Hello</p></main>` +
+		`<aside><div id="comments"><h2>2 comments</h2><ul><li>not a list</li></ul></div></aside>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestErrorBoundary_ErrorTemplateFails(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	templates := make(map[string]string)
+	for key, value := range errorBoundaryTemplates {
+		templates[key] = value
+	}
+	templates["comments-error.html"] = `<div>{{ .Data.Count.FAIL }}</div>`
+	exec := NewKeyedStringExecutor(templates)
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if got := strings.TrimSpace(sDumpBody(rec)); got != "Internal Server Error" {
+		t.Errorf("Expecting a plain error response, got %s", got)
+	}
+}
+
+func TestErrorBoundary_NestedBoundaries(t *testing.T) {
+	base, comments := setupErrorBoundary()
+	base.ErrorTemplate = "base-error.html"
+	templates := make(map[string]string)
+	for key, value := range errorBoundaryTemplates {
+		templates[key] = value
+	}
+	templates["comments-error.html"] = `<div>{{ .Data.Count.FAIL }}</div>`
+	templates["base-error.html"] = `<p>Page unavailable: {{ .Err }}</p>`
+	exec := NewKeyedStringExecutor(templates)
+	handler := exec.NewViewHandler(comments)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	expect := `<p>Page unavailable: template: comments:error:1:13: executing &#34;comments:error&#34; at ` +
+		`&lt;.Data.Count.FAIL&gt;: can&#39;t evaluate field FAIL in type interface {}</p>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestErrorBoundary_TemplateCache(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	files := make(fstest.MapFS)
+	for key, value := range errorBoundaryTemplates {
+		files[key] = &fstest.MapFile{Data: []byte(value)}
+	}
+	exec := &FSExecutor{FS: files, Cache: NewTemplateCache()}
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+		expect := `<main><p id="content">Hello</p></main>` +
+			`<aside><div id="comments">Comments unavailable for comments, 2</div></aside>`
+		if got := sDumpBody(rec); got != expect {
+			t.Errorf("Request %d: expecting body\n%s\nGOT\n%s", i, expect, got)
+		}
+	}
+}
+
+func TestErrorBoundary_LoadError(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	templates := make(map[string]string)
+	for key, value := range errorBoundaryTemplates {
+		templates[key] = value
+	}
+	delete(templates, "comments-error.html")
+	exec := NewKeyedStringExecutor(templates)
+	exec.NewViewHandler(base)
+	errs := exec.FlushErrors()
+	if len(errs) != 2 {
+		t.Fatalf("Expecting an error for the page and partial, got %v", errs)
+	}
+	if errs[0].View.Defines != "comments" {
+		t.Errorf("Expecting error to reference the comments view, got %s", SprintViewInfo(errs[0].View))
+	}
+	expect := `failed to load template "comments-error.html": no key found for template 'comments-error.html'`
+	if errs[0].Error() != expect {
+		t.Errorf("Expecting error %s, got %s", expect, errs[0])
+	}
+}
+
+func TestErrorBoundary_HandlerPanic(t *testing.T) {
+	tests := []struct {
+		name       string
+		concurrent bool
+		accept     string
+		expect     string
+	}{
+		{
+			name:   "page request",
+			accept: "text/html",
+			expect: `<main><p id="content">Hello</p></main><aside><div id="comments">Comments unavailable, *treetop.HandlerPanic</div></aside>`,
+		},
+		{
+			name:       "concurrent page request",
+			concurrent: true,
+			accept:     "text/html",
+			expect:     `<main><p id="content">Hello</p></main><aside><div id="comments">Comments unavailable, *treetop.HandlerPanic</div></aside>`,
+		},
+		{
+			name:   "template request",
+			accept: TemplateContentType,
+			expect: "<template>\n<div id=\"comments\">Comments unavailable, *treetop.HandlerPanic</div>\n</template>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, comments := setupErrorBoundary()
+			comments.SubViews["list"].HandlerFunc = func(rsp Response, req *http.Request) interface{} {
+				panic("something went wrong")
+			}
+			templates := make(map[string]string)
+			for key, value := range errorBoundaryTemplates {
+				templates[key] = value
+			}
+			templates["comments-error.html"] = `<div id="comments">Comments unavailable, {{ printf "%T" .Err }}</div>`
+			exec := NewKeyedStringExecutor(templates)
+			var handler ViewHandler
+			if tt.accept == TemplateContentType {
+				handler = exec.NewViewHandler(comments)
+			} else {
+				handler = exec.NewViewHandler(base)
+			}
+			if errs := exec.FlushErrors(); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			handler.(*TemplateHandler).ConcurrentSubViews = tt.concurrent
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, mockRequest("/some/path", tt.accept))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+			}
+			if got := sDumpBody(rec); got != tt.expect {
+				t.Errorf("Expecting body\n%s\nGOT\n%s", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestErrorBoundary_HandlerPanicNoBoundary(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	base.SubViews["content"].HandlerFunc = func(rsp Response, req *http.Request) interface{} {
+		panic("something went wrong")
+	}
+	exec := NewKeyedStringExecutor(errorBoundaryTemplates)
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if got := sDumpBody(rec); strings.Contains(got, "<main>") {
+		t.Errorf("Expecting the page not to be rendered, got %s", got)
+	}
+}
@@ -0,0 +1,95 @@
+package treetop
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl declares the HTTP caching intent of a view, see View.CacheControl.
+//
+// The TemplateHandler combines the declarations of all views in the page or partial
+// hierarchy using the most restrictive directives, in the same way that the greater status
+// code is chosen by Response.Status. For example, a page with a public view that can be cached
+// for an hour and a private view that can be cached for a minute will have the
+// header "Cache-Control: private, max-age=60".
+type CacheControl struct {
+	// MaxAge is the duration a response can be reused for, zero means not specified
+	MaxAge time.Duration
+	// Private indicates that the response is intended for a single user and must not
+	// be stored by a shared cache
+	Private bool
+	// NoCache requires that a cache validates the response before it is reused
+	NoCache bool
+	// NoStore indicates that the response must not be stored by any cache
+	NoStore bool
+}
+
+// String formats the directives as a Cache-Control header value
+func (cc *CacheControl) String() string {
+	if cc == nil {
+		return ""
+	}
+	if cc.NoStore {
+		return "no-store"
+	}
+	var directives []string
+	if cc.Private {
+		directives = append(directives, "private")
+	}
+	if cc.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if cc.MaxAge > 0 {
+		directives = append(directives, "max-age="+strconv.FormatInt(int64(cc.MaxAge/time.Second), 10))
+	}
+	return strings.Join(directives, ", ")
+}
+
+// merge combines two declarations, choosing the most restrictive directives of each
+func (cc *CacheControl) merge(other *CacheControl) *CacheControl {
+	if cc == nil {
+		return other
+	}
+	if other == nil {
+		return cc
+	}
+	merged := &CacheControl{
+		MaxAge:  cc.MaxAge,
+		Private: cc.Private || other.Private,
+		NoCache: cc.NoCache || other.NoCache,
+		NoStore: cc.NoStore || other.NoStore,
+	}
+	if merged.MaxAge <= 0 || (other.MaxAge > 0 && other.MaxAge < merged.MaxAge) {
+		merged.MaxAge = other.MaxAge
+	}
+	return merged
+}
+
+// viewCacheControl combines the cache control declarations of view hierarchies,
+// nil is returned if no view has a declaration
+func viewCacheControl(views ...*View) *CacheControl {
+	var cc *CacheControl
+	for _, v := range views {
+		if v == nil {
+			continue
+		}
+		cc = cc.merge(v.CacheControl)
+		for _, sub := range v.SubViews {
+			cc = cc.merge(viewCacheControl(sub))
+		}
+	}
+	return cc
+}
+
+// setCacheControl adds the Cache-Control header for the declarations of the views in a response.
+// The header is not changed if it was set by a handler, or the response status is an error.
+func setCacheControl(header http.Header, cc *CacheControl, status int) {
+	if cc == nil || status >= http.StatusBadRequest || header.Get("Cache-Control") != "" {
+		return
+	}
+	if value := cc.String(); value != "" {
+		header.Set("Cache-Control", value)
+	}
+}
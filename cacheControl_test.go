@@ -0,0 +1,131 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControl_String(t *testing.T) {
+	tests := []struct {
+		cc     *CacheControl
+		expect string
+	}{
+		{nil, ""},
+		{&CacheControl{}, ""},
+		{&CacheControl{MaxAge: time.Minute}, "max-age=60"},
+		{&CacheControl{MaxAge: time.Hour, Private: true}, "private, max-age=3600"},
+		{&CacheControl{NoCache: true, Private: true}, "private, no-cache"},
+		{&CacheControl{NoStore: true, MaxAge: time.Hour}, "no-store"},
+	}
+	for _, tt := range tests {
+		if got := tt.cc.String(); got != tt.expect {
+			t.Errorf("Expecting %q, got %q", tt.expect, got)
+		}
+	}
+}
+
+func TestCacheControl_Merge(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   *CacheControl
+		expect string
+	}{
+		{
+			name:   "nil",
+			a:      nil,
+			b:      &CacheControl{MaxAge: time.Minute},
+			expect: "max-age=60",
+		},
+		{
+			name:   "shortest max age",
+			a:      &CacheControl{MaxAge: time.Hour},
+			b:      &CacheControl{MaxAge: time.Minute},
+			expect: "max-age=60",
+		},
+		{
+			name:   "unspecified max age",
+			a:      &CacheControl{MaxAge: time.Hour},
+			b:      &CacheControl{Private: true},
+			expect: "private, max-age=3600",
+		},
+		{
+			name:   "no store",
+			a:      &CacheControl{MaxAge: time.Hour, Private: true},
+			b:      &CacheControl{NoStore: true},
+			expect: "no-store",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.a.merge(tt.b).String(); got != tt.expect {
+			t.Errorf("%s: expecting %q, got %q", tt.name, tt.expect, got)
+		}
+		if got := tt.b.merge(tt.a).String(); got != tt.expect {
+			t.Errorf("%s reversed: expecting %q, got %q", tt.name, tt.expect, got)
+		}
+	}
+}
+
+func setupCacheControlHandler() (*View, *View) {
+	base := NewView(`<div>{{ template "content" .Content }}{{ template "user" .User }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+			"User":    rsp.HandleSubView("user", req),
+		}
+	})
+	base.CacheControl = &CacheControl{MaxAge: time.Hour}
+	user := base.NewDefaultSubView("user", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		if req.URL.Query().Get("fail") != "" {
+			rsp.Status(http.StatusInternalServerError)
+		}
+		if req.URL.Query().Get("override") != "" {
+			rsp.Header().Set("Cache-Control", "no-cache")
+		}
+		return "user"
+	})
+	user.CacheControl = &CacheControl{MaxAge: 10 * time.Minute, Private: true}
+	content := base.NewDefaultSubView("content", `<p>{{ . }}</p>`, Constant("content"))
+	content.CacheControl = &CacheControl{MaxAge: time.Minute}
+	return base, content
+}
+
+func TestTemplateHandler_CacheControl(t *testing.T) {
+	_, content := setupCacheControlHandler()
+	exec := StringExecutor{}
+	handler := exec.NewViewHandler(content)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tests := []struct {
+		path   string
+		accept string
+		expect string
+	}{
+		{"/", "text/html", "private, max-age=60"},
+		{"/", TemplateContentType, "max-age=60"},
+		{"/?fail=1", "text/html", ""},
+		{"/?override=1", "text/html", "no-cache"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, mockRequest(tt.path, tt.accept))
+		if got := rec.Header().Get("Cache-Control"); got != tt.expect {
+			t.Errorf("%s %s: expecting Cache-Control %q, got %q", tt.path, tt.accept, tt.expect, got)
+		}
+	}
+}
+
+func TestTemplateHandler_CacheControlStreamPage(t *testing.T) {
+	base, _ := setupCacheControlHandler()
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.StreamPage = true
+
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/", "text/html"))
+	if got := rec.Header().Get("Cache-Control"); got != "private, max-age=60" {
+		t.Errorf("Expecting Cache-Control %q, got %q", "private, max-age=60", got)
+	}
+}
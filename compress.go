@@ -0,0 +1,161 @@
+package treetop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the smallest response body that will be compressed
+// when the handler does not specify a threshold
+const DefaultCompressMinSize = 1024
+
+// Encoder compresses response bodies using an HTTP content coding, see TemplateHandler.Encoders.
+// Other codings such as brotli can be supported by implementing this interface.
+type Encoder interface {
+	// Encoding is the content coding token used for negotiation, for example "gzip"
+	Encoding() string
+	// Encode writes the compressed form of src to dst
+	Encode(dst io.Writer, src []byte) error
+}
+
+// GzipEncoder compresses response bodies using gzip. The Level is a compression level
+// from the compress/gzip package, the default compression level is used when it is zero.
+type GzipEncoder struct {
+	Level int
+}
+
+// gzip writers are pooled for each compression level, from HuffmanOnly (-2) to BestCompression (9)
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// Encoding implements Encoder
+func (ge GzipEncoder) Encoding() string {
+	return "gzip"
+}
+
+// Encode implements Encoder
+func (ge GzipEncoder) Encode(dst io.Writer, src []byte) error {
+	level := ge.Level
+	if level == gzip.NoCompression {
+		level = gzip.DefaultCompression
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		_, err := gzip.NewWriterLevel(dst, level)
+		return err
+	}
+	pool := &gzipWriters[level-gzip.HuffmanOnly]
+	gz, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		gz.Reset(dst)
+	} else {
+		gz, _ = gzip.NewWriterLevel(dst, level)
+	}
+	defer pool.Put(gz)
+	if _, err := gz.Write(src); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// negotiateEncoder chooses an encoder for a response body using the Accept-Encoding header
+// of the request. Encoders are listed in order of preference, nil is returned when the
+// body should not be encoded.
+func negotiateEncoder(acceptEncoding string, encoders []Encoder) Encoder {
+	if acceptEncoding == "" || len(encoders) == 0 {
+		return nil
+	}
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, element := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(element, ";")
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if coding == "" {
+			continue
+		}
+		q, valid := 1.0, true
+		for _, param := range parts[1:] {
+			name, value, ok := cutParam(param)
+			if !ok || name != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				valid = false
+				break
+			}
+			q = parsed
+		}
+		if !valid {
+			// ignore elements with an invalid quality value
+			continue
+		}
+		if coding == "*" {
+			wildcard = q
+		} else {
+			qualities[coding] = q
+		}
+	}
+
+	var (
+		chosen Encoder
+		best   float64
+	)
+	for _, enc := range encoders {
+		q, ok := qualities[strings.ToLower(enc.Encoding())]
+		if !ok {
+			q = wildcard
+		}
+		if q > best {
+			chosen, best = enc, q
+		}
+	}
+	return chosen
+}
+
+// addVary will add a token to the Vary header unless it is already present
+func addVary(header http.Header, token string) {
+	for _, value := range header.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, token) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", token)
+}
+
+// responseEncoder chooses an encoder for a buffered response body if the client accepts one
+// of the configured encodings and the body is large enough. Nil is returned when the body
+// should not be encoded.
+func (h *TemplateHandler) responseEncoder(header http.Header, req *http.Request, body []byte) Encoder {
+	if len(h.Encoders) == 0 {
+		return nil
+	}
+	minSize := h.CompressMinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	if len(body) < minSize {
+		return nil
+	}
+	// the response can vary by encoding, even if the client has not accepted one
+	addVary(header, "Accept-Encoding")
+	return negotiateEncoder(strings.Join(req.Header.Values("Accept-Encoding"), ","), h.Encoders)
+}
+
+// encodeResponseBody will compress a buffered response body using the encoder chosen for the
+// response. The encoded body is returned, it must be released by the caller.
+func encodeResponseBody(header http.Header, enc Encoder, body []byte) (*bytes.Buffer, error) {
+	out := getBuffer()
+	if err := enc.Encode(out, body); err != nil {
+		releaseBuffer(out)
+		return nil, err
+	}
+	header.Set("Content-Encoding", enc.Encoding())
+	return out, nil
+}
@@ -0,0 +1,297 @@
+package treetop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func setupCompressHandler(text string) *TemplateHandler {
+	base := NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		return text
+	})
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(content).(*TemplateHandler)
+	th.Encoders = []Encoder{GzipEncoder{}}
+	return th
+}
+
+// reverseEncoder is a fake content coding for testing
+type reverseEncoder struct{}
+
+func (reverseEncoder) Encoding() string { return "reverse" }
+
+func (reverseEncoder) Encode(dst io.Writer, src []byte) error {
+	out := make([]byte, len(src))
+	for i, b := range src {
+		out[len(src)-1-i] = b
+	}
+	_, err := dst.Write(out)
+	return err
+}
+
+// countingEncoder records the number of response bodies it has encoded
+type countingEncoder struct {
+	count *int
+}
+
+func (countingEncoder) Encoding() string { return "counting" }
+
+func (ce countingEncoder) Encode(dst io.Writer, src []byte) error {
+	*ce.count++
+	_, err := dst.Write(src)
+	return err
+}
+
+func gunzip(t *testing.T, body []byte) string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to read gzip body: %s", err)
+	}
+	out, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to decompress gzip body: %s", err)
+	}
+	return string(out)
+}
+
+func TestTemplateHandler_Compress(t *testing.T) {
+	text := strings.Repeat("Hello ", 300)
+	th := setupCompressHandler(text)
+	tests := []struct {
+		accept string
+		expect string
+		vary   string
+	}{
+		{
+			accept: "text/html",
+			expect: "<div><p>" + text + "</p></div>",
+			vary:   "Accept, Accept-Encoding",
+		},
+		{
+			accept: TemplateContentType,
+			expect: "<template>\n<p>" + text + "</p>\n</template>",
+			vary:   "Accept-Encoding, Accept",
+		},
+	}
+	for _, tt := range tests {
+		req := mockRequest("/some/path", tt.accept)
+		req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Accept %s: expecting gzip content encoding, got %q", tt.accept, got)
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+			t.Errorf("Accept %s: expecting content length %d, got %s", tt.accept, rec.Body.Len(), got)
+		}
+		if rec.Body.Len() >= len(tt.expect) {
+			t.Errorf("Accept %s: expecting body to be compressed, got %d bytes", tt.accept, rec.Body.Len())
+		}
+		if got := strings.Join(rec.Header().Values("Vary"), ", "); got != tt.vary {
+			t.Errorf("Accept %s: expecting Vary %q, got %q", tt.accept, tt.vary, got)
+		}
+		if got := gunzip(t, rec.Body.Bytes()); got != tt.expect {
+			t.Errorf("Accept %s: expecting body %q, got %q", tt.accept, tt.expect, got)
+		}
+	}
+}
+
+func TestTemplateHandler_CompressNotApplied(t *testing.T) {
+	long := strings.Repeat("Hello ", 300)
+	tests := []struct {
+		name           string
+		text           string
+		minSize        int
+		acceptEncoding string
+		vary           string
+	}{
+		{
+			name:           "below default threshold",
+			text:           "Hello",
+			acceptEncoding: "gzip",
+			vary:           "Accept",
+		},
+		{
+			name:           "below custom threshold",
+			text:           long,
+			minSize:        4096,
+			acceptEncoding: "gzip",
+			vary:           "Accept",
+		},
+		{
+			name:           "no accept encoding",
+			text:           long,
+			acceptEncoding: "",
+			vary:           "Accept, Accept-Encoding",
+		},
+		{
+			name:           "gzip not acceptable",
+			text:           long,
+			acceptEncoding: "gzip;q=0, br",
+			vary:           "Accept, Accept-Encoding",
+		},
+		{
+			name:           "wildcard not acceptable",
+			text:           long,
+			acceptEncoding: "*;q=0, identity",
+			vary:           "Accept, Accept-Encoding",
+		},
+	}
+	for _, tt := range tests {
+		th := setupCompressHandler(tt.text)
+		th.CompressMinSize = tt.minSize
+		req := mockRequest("/some/path", "text/html")
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: expecting no content encoding, got %q", tt.name, got)
+		}
+		expect := "<div><p>" + tt.text + "</p></div>"
+		if got := rec.Body.String(); got != expect {
+			t.Errorf("%s: expecting plain body, got %q", tt.name, got)
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(expect)) {
+			t.Errorf("%s: expecting content length %d, got %s", tt.name, len(expect), got)
+		}
+		if got := strings.Join(rec.Header().Values("Vary"), ", "); got != tt.vary {
+			t.Errorf("%s: expecting Vary %q, got %q", tt.name, tt.vary, got)
+		}
+	}
+}
+
+func TestTemplateHandler_CompressCustomEncoder(t *testing.T) {
+	th := setupCompressHandler("Hello")
+	th.Encoders = []Encoder{GzipEncoder{Level: gzip.BestSpeed}, reverseEncoder{}}
+	th.CompressMinSize = 1
+
+	req := mockRequest("/some/path", "text/html")
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, reverse")
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Encoding"); got != "reverse" {
+		t.Fatalf("Expecting reverse content encoding, got %q", got)
+	}
+	if got := rec.Body.String(); got != ">vid/<>p/<olleH>p<>vid<" {
+		t.Errorf("Unexpected encoded body %q", got)
+	}
+
+	// equal weight, the first encoder listed is preferred
+	req = mockRequest("/some/path", "text/html")
+	req.Header.Set("Accept-Encoding", "reverse, gzip")
+	rec = httptest.NewRecorder()
+	th.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expecting gzip content encoding, got %q", got)
+	}
+	if got := gunzip(t, rec.Body.Bytes()); got != "<div><p>Hello</p></div>" {
+		t.Errorf("Unexpected decompressed body %q", got)
+	}
+}
+
+func TestTemplateHandler_CompressETag(t *testing.T) {
+	th := setupCompressHandler(strings.Repeat("Hello ", 300))
+	th.ETags = true
+	for _, accept := range []string{"text/html", TemplateContentType} {
+		plain := httptest.NewRecorder()
+		th.ServeHTTP(plain, mockRequest("/some/path", accept))
+
+		req := mockRequest("/some/path", accept)
+		req.Header.Set("Accept-Encoding", "gzip")
+		compressed := httptest.NewRecorder()
+		th.ServeHTTP(compressed, req)
+
+		plainTag, compressedTag := plain.Header().Get("ETag"), compressed.Header().Get("ETag")
+		if plainTag == "" || plainTag == compressedTag {
+			t.Errorf("Accept %s: expecting ETags to differ by encoding, got %q and %q", accept, plainTag, compressedTag)
+		}
+
+		req = mockRequest("/some/path", accept)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", compressedTag)
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("Accept %s: expecting status 304, got %d", accept, rec.Code)
+		}
+	}
+}
+
+func TestTemplateHandler_CompressNotModified(t *testing.T) {
+	th := setupCompressHandler("Hello")
+	var count int
+	th.Encoders = []Encoder{countingEncoder{&count}}
+	th.CompressMinSize = 1
+	th.ETags = true
+	for _, accept := range []string{"text/html", TemplateContentType} {
+		count = 0
+		req := mockRequest("/some/path", accept)
+		req.Header.Set("Accept-Encoding", "counting")
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, req)
+		if count != 1 {
+			t.Fatalf("Accept %s: expecting the body to be encoded once, got %d", accept, count)
+		}
+
+		req = mockRequest("/some/path", accept)
+		req.Header.Set("Accept-Encoding", "counting")
+		req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+		rec = httptest.NewRecorder()
+		th.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("Accept %s: expecting status 304, got %d", accept, rec.Code)
+		}
+		if count != 1 {
+			t.Errorf("Accept %s: expecting the body not to be encoded for a 304 response, got %d", accept, count)
+		}
+		if got := rec.Header().Get("Content-Length"); got != "" {
+			t.Errorf("Accept %s: expecting no Content-Length for a 304 response, got %s", accept, got)
+		}
+	}
+}
+
+func TestNegotiateEncoder(t *testing.T) {
+	encoders := []Encoder{GzipEncoder{}, reverseEncoder{}}
+	tests := []struct {
+		header string
+		expect string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"identity", ""},
+		{"reverse", "reverse"},
+		{"gzip;q=0.2, reverse;q=0.5", "reverse"},
+		{"gzip;q=0", ""},
+		{"gzip;q=abc, reverse", "reverse"},
+		{"*", "gzip"},
+		{"*;q=0.1, reverse;q=0.2", "reverse"},
+		{"gzip;q=0, *", "reverse"},
+		{"*;q=0", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if enc := negotiateEncoder(tt.header, encoders); enc != nil {
+			got = enc.Encoding()
+		}
+		if got != tt.expect {
+			t.Errorf("Accept-Encoding %q: expecting %q, got %q", tt.header, tt.expect, got)
+		}
+	}
+}
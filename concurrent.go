@@ -0,0 +1,238 @@
+package treetop
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// concurrentState is shared by all response wrappers derived for a treetop response
+// which is executing sub view handlers concurrently.
+type concurrentState struct {
+	mu    sync.Mutex
+	owner *ResponseWrapper
+}
+
+// claim will attempt to give the supplied response wrapper exclusive control of
+// writing to the response. Only the first response wrapper to make a claim will succeed.
+func (cs *concurrentState) claim(rsp *ResponseWrapper) bool {
+	if cs == nil {
+		return true
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.owner == nil {
+		cs.owner = rsp
+	}
+	return cs.owner == rsp
+}
+
+// pendingSubView is a sub view handler which has been started in a separate goroutine
+// ahead of the parent handler requesting the data.
+type pendingSubView struct {
+	rsp       *ResponseWrapper
+	rec       *subViewRecorder
+	done      chan struct{}
+	data      interface{}
+	panicked  bool
+	recovered interface{}
+	received  bool
+}
+
+// subViewRecorder stands in for the http.ResponseWriter of a sub view handler executing
+// concurrently. Headers and any output written while hijacking the response are recorded
+// and copied to the parent response writer once the handler is done.
+type subViewRecorder struct {
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	written bool
+}
+
+func newSubViewRecorder() *subViewRecorder {
+	return &subViewRecorder{
+		header: make(http.Header),
+	}
+}
+
+// Header implements http.ResponseWriter
+func (rec *subViewRecorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rec *subViewRecorder) WriteHeader(status int) {
+	if rec.written {
+		return
+	}
+	rec.status = status
+	rec.written = true
+}
+
+// Write implements http.ResponseWriter
+func (rec *subViewRecorder) Write(b []byte) (int, error) {
+	if !rec.written {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return rec.body.Write(b)
+}
+
+// replay will copy the recorded response to a another writer
+func (rec *subViewRecorder) replay(w http.ResponseWriter) {
+	mergeHeader(w.Header(), rec.header)
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
+
+// mergeHeader adds all values from the src header to the dst header
+func mergeHeader(dst, src http.Header) {
+	for key, values := range src {
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+// execute will obtain the data for a view with this response. The handler is not executed
+// when the view has a cache policy and the rendered fragment is available.
+func (rsp *ResponseWrapper) execute(view *View, req *http.Request) interface{} {
+	if isCached(view) && rsp.fragments != nil {
+		return rsp.executeCached(view, req)
+	}
+	return rsp.executeHandler(view, req)
+}
+
+// executeHandler will invoke the handler function of a view with this response. Sub view
+// handlers started by PrefetchSubViews will be collected before returning.
+// A panic will be converted to a *HandlerPanic, which is recovered when the view has an
+// error template so that the template of the view can be substituted.
+func (rsp *ResponseWrapper) executeHandler(view *View, req *http.Request) (data interface{}) {
+	if rsp.failures != nil && view.ErrorTemplate != "" && view.Defines != "" {
+		defer rsp.recoverViewFailure(view, &data)
+	}
+	defer recoverHandlerPanic(view)
+	defer rsp.observeHandler(req, view)()
+	defer rsp.joinSubViews()
+	return view.HandlerFunc(rsp, req)
+}
+
+// PrefetchSubViews begins executing the handlers of the named sub views in separate goroutines,
+// so that slow handlers run in parallel. A later call to HandleSubView for the name will wait
+// for the data. If no names are given the handlers of all sub views are started.
+//
+// This has no effect unless the TemplateHandler has ConcurrentSubViews enabled, in which case
+// HandleSubView executes the handler when it is called.
+//
+// Example:
+//
+//	func pageHandler(rsp treetop.Response, req *http.Request) interface{} {
+//		treetop.PrefetchSubViews(rsp, req, "sidebar", "content")
+//		return map[string]interface{}{
+//			"Sidebar": rsp.HandleSubView("sidebar", req),
+//			"Content": rsp.HandleSubView("content", req),
+//		}
+//	}
+func PrefetchSubViews(rsp Response, req *http.Request, names ...string) {
+	if rw, ok := rsp.(*ResponseWrapper); ok {
+		rw.startSubViews(req, names)
+	}
+}
+
+// startSubViews begins executing the handlers of the named sub views in separate goroutines,
+// all sub views are started if no names are given.
+// This has no effect unless the response is handling sub views concurrently.
+func (rsp *ResponseWrapper) startSubViews(req *http.Request, names []string) {
+	if rsp.shared == nil || len(rsp.subViews) == 0 || rsp.Finished() {
+		return
+	}
+	if len(names) == 0 {
+		for name := range rsp.subViews {
+			names = append(names, name)
+		}
+	}
+	if rsp.pending == nil {
+		rsp.pending = make(map[string]*pendingSubView, len(names))
+	}
+	for _, name := range names {
+		sub := rsp.subViews[name]
+		if _, started := rsp.pending[name]; started || sub == nil {
+			continue
+		}
+		p := &pendingSubView{
+			rsp:  rsp.WithSubViews(sub.SubViews),
+			rec:  newSubViewRecorder(),
+			done: make(chan struct{}),
+		}
+		// a detached response does not share headers or state with the parent
+		// until the data has been received
+		p.rsp.ResponseWriter = p.rec
+		p.rsp.detached = true
+		rsp.pending[name] = p
+
+		go func(p *pendingSubView, sub *View) {
+			defer close(p.done)
+			defer func() {
+				if r := recover(); r != nil {
+					p.panicked = true
+					p.recovered = r
+				}
+			}()
+			p.data = p.rsp.execute(sub, req)
+		}(p, sub)
+	}
+}
+
+// receive waits for a pending sub view handler to complete and adopts the
+// status, headers and page URL of the sub view response.
+// Nil will be returned if the treetop response is finished in the meantime.
+func (rsp *ResponseWrapper) receive(p *pendingSubView) interface{} {
+	select {
+	case <-p.done:
+	default:
+		select {
+		case <-p.done:
+		case <-rsp.context.Done():
+			return nil
+		}
+	}
+	p.received = true
+	if p.panicked {
+		panic(p.recovered)
+	}
+	if p.rec.written {
+		// sub view handler hijacked the response
+		p.rec.replay(rsp.ResponseWriter)
+		return p.data
+	}
+	mergeHeader(rsp.Header(), p.rec.header)
+	rsp.Status(p.rsp.status)
+	if p.rsp.pageURLSpecified {
+		if p.rsp.replaceURL {
+			rsp.ReplacePageURL(p.rsp.pageURL)
+		} else {
+			rsp.DesignatePageURL(p.rsp.pageURL)
+		}
+	}
+	return p.data
+}
+
+// joinSubViews waits for all sub view handlers that were prefetched by this response to complete.
+// Data from sub views that were not requested by the handler is discarded, unless the sub
+// view took control of writing the response.
+func (rsp *ResponseWrapper) joinSubViews() {
+	pending := rsp.pending
+	rsp.pending = nil
+	for _, p := range pending {
+		<-p.done
+		if p.received {
+			continue
+		}
+		p.received = true
+		if p.panicked {
+			panic(p.recovered)
+		}
+		if p.rec.written {
+			p.rec.replay(rsp.ResponseWriter)
+		}
+	}
+}
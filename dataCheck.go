@@ -0,0 +1,238 @@
+package treetop
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// DeclareData records the type of data returned by the handler of the view using a sample
+// value, the view is returned. See NewTypedView for views with a typed handler function.
+//
+// When the type of data is known for a view, field and method references in the view template
+// are checked as the handler is constructed. Mismatches are reported by the FlushErrors
+// method of the executor, rather than when the template is executed.
+//
+// Example:
+//
+//	content := base.NewDefaultSubView("content", "content.html", contentHandler).
+//		DeclareData(ContentData{})
+func (v *View) DeclareData(sample interface{}) *View {
+	v.dataType = reflect.TypeOf(sample)
+	return v
+}
+
+// dataChecker walks the parse tree of a view template, verifying field and method
+// references against the declared type of the view data
+type dataChecker struct {
+	view     *View
+	tmpl     *template.Template
+	visited  map[string]bool
+	problems []string
+}
+
+// checkTemplateData will verify the field and method chains of a view template using the type of
+// the view data. Data passed to a sub view block must be assignable from the data type of the sub view.
+//
+// References are checked where the type of dot can be determined, within with and range actions and
+// other templates defined by the view. Variables other than $ are not checked.
+func checkTemplateData(tmpl *template.Template, v *View) error {
+	if v.dataType == nil || tmpl == nil || tmpl.Tree == nil {
+		return nil
+	}
+	dc := &dataChecker{
+		view:    v,
+		tmpl:    tmpl,
+		visited: make(map[string]bool),
+	}
+	dc.walk(tmpl.Tree, tmpl.Tree.Root, v.dataType, v.dataType)
+	if len(dc.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("template data does not match view data type %s: %s", v.dataType, strings.Join(dc.problems, ", "))
+}
+
+// report records a problem at the location of a node
+func (dc *dataChecker) report(tree *parse.Tree, node parse.Node, format string, args ...interface{}) {
+	location, _ := tree.ErrorContext(node)
+	location = strings.TrimPrefix(location, tree.ParseName+":")
+	dc.problems = append(dc.problems, fmt.Sprintf("line %s: %s", location, fmt.Sprintf(format, args...)))
+}
+
+// walk checks the nodes of a list, dot is the type of the data at this point in the
+// template and root is the type of the template data. A nil type is unknown.
+func (dc *dataChecker) walk(tree *parse.Tree, list *parse.ListNode, dot, root reflect.Type) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			dc.pipeType(tree, n.Pipe, dot, root)
+		case *parse.IfNode:
+			dc.pipeType(tree, n.Pipe, dot, root)
+			dc.walk(tree, n.List, dot, root)
+			dc.walk(tree, n.ElseList, dot, root)
+		case *parse.WithNode:
+			t := dc.pipeType(tree, n.Pipe, dot, root)
+			dc.walk(tree, n.List, t, root)
+			dc.walk(tree, n.ElseList, dot, root)
+		case *parse.RangeNode:
+			t := dc.pipeType(tree, n.Pipe, dot, root)
+			dc.walk(tree, n.List, rangeElem(t), root)
+			dc.walk(tree, n.ElseList, dot, root)
+		case *parse.TemplateNode:
+			dc.template(tree, n, dot, root)
+		case *parse.ListNode:
+			dc.walk(tree, n, dot, root)
+		}
+	}
+}
+
+// template checks the data passed to a sub view block or another template
+func (dc *dataChecker) template(tree *parse.Tree, n *parse.TemplateNode, dot, root reflect.Type) {
+	var t reflect.Type
+	if n.Pipe != nil {
+		t = dc.pipeType(tree, n.Pipe, dot, root)
+	}
+	if sub, ok := dc.view.SubViews[n.Name]; ok {
+		switch {
+		case n.Pipe == nil:
+			dc.report(tree, n, "sub view block %q: no data is passed to the sub view", n.Name)
+		case t != nil && sub != nil && sub.dataType != nil && !sub.dataType.AssignableTo(t):
+			dc.report(tree, n, "sub view block %q: %s has type %s, the sub view data has type %s",
+				n.Name, n.Pipe, t, sub.dataType)
+		}
+		return
+	}
+	if t == nil {
+		return
+	}
+	// check a template defined by the view with the type of data passed to it
+	key := n.Name + "\x00" + t.String()
+	if dc.visited[key] {
+		return
+	}
+	dc.visited[key] = true
+	if called := dc.tmpl.Lookup(n.Name); called != nil && called.Tree != nil {
+		dc.walk(called.Tree, called.Tree.Root, t, t)
+	}
+}
+
+// pipeType checks the commands of a pipeline and returns the type of the result,
+// if it can be determined
+func (dc *dataChecker) pipeType(tree *parse.Tree, pipe *parse.PipeNode, dot, root reflect.Type) reflect.Type {
+	if pipe == nil {
+		return nil
+	}
+	var t reflect.Type
+	for _, cmd := range pipe.Cmds {
+		t = nil
+		for i, arg := range cmd.Args {
+			argT := dc.argType(tree, arg, dot, root)
+			if i == 0 {
+				t = argT
+			}
+		}
+	}
+	if len(pipe.Cmds) != 1 {
+		return nil
+	}
+	return t
+}
+
+// argType checks a command argument and returns the type, if it can be determined
+func (dc *dataChecker) argType(tree *parse.Tree, arg parse.Node, dot, root reflect.Type) reflect.Type {
+	switch a := arg.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return dc.resolve(tree, a, dot, a.Ident)
+	case *parse.VariableNode:
+		if a.Ident[0] != "$" {
+			return nil
+		}
+		return dc.resolve(tree, a, root, a.Ident[1:])
+	case *parse.ChainNode:
+		return dc.resolve(tree, a, dc.argType(tree, a.Node, dot, root), a.Field)
+	case *parse.PipeNode:
+		return dc.pipeType(tree, a, dot, root)
+	}
+	return nil
+}
+
+// resolve the type of a field chain, reporting a problem if it is not valid
+func (dc *dataChecker) resolve(tree *parse.Tree, node parse.Node, t reflect.Type, path []string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	resolved, err := resolveFieldType(t, path)
+	if err != nil {
+		dc.report(tree, node, "%s", err)
+		return nil
+	}
+	return resolved
+}
+
+// rangeElem returns the type of dot within a range action
+func rangeElem(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return t.Elem()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return t
+	}
+	return nil
+}
+
+// resolveFieldType finds the type of a chain of fields or methods, as they would be
+// evaluated by a template. A nil type is returned if it cannot be known before execution.
+func resolveFieldType(t reflect.Type, path []string) (reflect.Type, error) {
+	for i, name := range path {
+		if t.Kind() == reflect.Interface {
+			return nil, nil
+		}
+		m, ok := t.MethodByName(name)
+		if !ok && t.Kind() != reflect.Pointer {
+			// the method of an addressable value can have a pointer receiver
+			m, ok = reflect.PointerTo(t).MethodByName(name)
+		}
+		if ok {
+			if m.Type.NumOut() == 0 {
+				return nil, fmt.Errorf("method .%s of %s has no result", name, t)
+			}
+			t = m.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Interface:
+			return nil, nil
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("cannot evaluate field .%s of %s", name, t)
+			}
+			t = t.Elem()
+		case reflect.Struct:
+			f, ok := t.FieldByName(name)
+			if !ok || !f.IsExported() {
+				return nil, fmt.Errorf("%s has no field or method .%s", t, strings.Join(path[:i+1], "."))
+			}
+			t = f.Type
+		default:
+			return nil, fmt.Errorf("cannot evaluate field .%s of %s", name, t)
+		}
+	}
+	return t, nil
+}
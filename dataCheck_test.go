@@ -0,0 +1,105 @@
+package treetop
+
+import (
+	"strings"
+	"testing"
+)
+
+type checkItem struct {
+	Name  string
+	Price float64
+}
+
+type checkData struct {
+	Title string
+	Items []checkItem
+	User  *checkUser
+	Meta  map[string]string
+	Extra interface{}
+}
+
+type checkUser struct {
+	Email string
+}
+
+func (u *checkUser) Display() string {
+	return u.Email
+}
+
+func TestCheckTemplateData(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expect   []string
+	}{
+		{
+			name: "valid",
+			template: `<h1>{{ .Title }}</h1>` +
+				`{{ range .Items }}<p>{{ .Name }} {{ printf "%.2f" .Price }}</p>{{ else }}{{ .Title }}{{ end }}` +
+				`{{ with .User }}{{ .Display }} {{ .Email }} {{ $.Title }}{{ end }}` +
+				`{{ .Meta.anything }} {{ .Extra.Anything.Goes }} {{ (index .Items 0).Name }}` +
+				`{{ range $i, $item := .Items }}{{ $item.Unknown }}{{ end }}` +
+				`{{ range 3 }}{{ . }}{{ end }}`,
+		},
+		{
+			name:     "missing field",
+			template: `<h1>{{ .Titel }}</h1>`,
+			expect:   []string{"line 1:7: treetop.checkData has no field or method .Titel"},
+		},
+		{
+			name:     "range and with",
+			template: `{{ range .Items }}{{ .Title }}{{ end }}{{ with .User }}{{ .Name }}{{ end }}`,
+			expect: []string{
+				"line 1:21: treetop.checkItem has no field or method .Title",
+				"line 1:58: treetop.checkUser has no field or method .Name",
+			},
+		},
+		{
+			name:     "field of basic type",
+			template: `{{ .Title.Length }} {{ $.User.Email.Domain }}`,
+			expect: []string{
+				"line 1:9: cannot evaluate field .Length of string",
+				"line 1:24: cannot evaluate field .Domain of string",
+			},
+		},
+		{
+			name:     "defined template",
+			template: `{{ define "item" }}{{ .Name }} {{ .Cost }}{{ end }}{{ range .Items }}{{ template "item" . }}{{ end }}`,
+			expect:   []string{"line 1:34: treetop.checkItem has no field or method .Cost"},
+		},
+	}
+	for _, tt := range tests {
+		v := NewView(tt.template, Noop).DeclareData(checkData{})
+		exec := StringExecutor{}
+		exec.NewViewHandler(v)
+		errs := exec.FlushErrors()
+		if len(tt.expect) == 0 {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %s", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 {
+			t.Errorf("%s: expecting an error", tt.name)
+			continue
+		}
+		if errs[0].View != v {
+			t.Errorf("%s: expecting error to reference the view", tt.name)
+		}
+		got := errs[0].Error()
+		for _, expect := range tt.expect {
+			if !strings.Contains(got, expect) {
+				t.Errorf("%s: expecting error to contain %q, got %q", tt.name, expect, got)
+			}
+		}
+	}
+}
+
+func TestCheckTemplateData_Undeclared(t *testing.T) {
+	v := NewView(`{{ .Anything }}`, Noop)
+	exec := StringExecutor{}
+	exec.NewViewHandler(v)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Errorf("Expecting views without a data type not to be checked, got %s", errs)
+	}
+}
@@ -0,0 +1,56 @@
+package treetop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// newETag creates a strong entity tag from the content of a response. The representation
+// is included so that the HTML document and the template fragment for a URL do not share a tag.
+func newETag(representation string, body []byte, extra ...string) string {
+	h := sha256.New()
+	h.Write([]byte(representation))
+	for _, value := range extra {
+		h.Write([]byte{0})
+		h.Write([]byte(value))
+	}
+	h.Write([]byte{0})
+	h.Write(body)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatch reports whether an If-None-Match header value matches the entity tag,
+// using the weak comparison function as required by RFC 7232
+func etagMatch(ifNoneMatch, etag string) bool {
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+	if ifNoneMatch == "" {
+		return false
+	}
+	if ifNoneMatch == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotModified will set the ETag header for a response body and report whether the client
+// already has the representation, in which case the body should not be sent.
+// Only successful responses to GET and HEAD requests are tagged.
+func checkNotModified(header http.Header, req *http.Request, status int, etag string) bool {
+	if status != 0 && status != http.StatusOK {
+		return false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	header.Set("ETag", etag)
+	return etagMatch(req.Header.Get("If-None-Match"), etag)
+}
@@ -0,0 +1,105 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func setupETagHandler() *TemplateHandler {
+	base := NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		if req.URL.Query().Get("missing") != "" {
+			rsp.Status(http.StatusNotFound)
+		}
+		return "Hello"
+	})
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(content).(*TemplateHandler)
+	th.ETags = true
+	return th
+}
+
+func TestTemplateHandler_ETagNotModified(t *testing.T) {
+	th := setupETagHandler()
+	for _, accept := range []string{"text/html", TemplateContentType} {
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, mockRequest("/some/path", accept))
+		etag := rec.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("Accept %s: expecting an ETag header", accept)
+		}
+
+		for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+			req := mockRequest("/some/path", accept)
+			req.Header.Set("If-None-Match", ifNoneMatch)
+			rec = httptest.NewRecorder()
+			th.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("Accept %s, If-None-Match %s: expecting status 304, got %d", accept, ifNoneMatch, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Accept %s, If-None-Match %s: expecting an empty body, got %s", accept, ifNoneMatch, rec.Body)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("Accept %s: expecting ETag %s, got %s", accept, etag, got)
+			}
+			if got := rec.Header().Get("Content-Length"); got != "" {
+				t.Errorf("Accept %s: expecting no content length, got %s", accept, got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Accept %s: expecting Vary Accept, got %s", accept, got)
+			}
+		}
+	}
+}
+
+func TestTemplateHandler_ETagVariesByRepresentation(t *testing.T) {
+	th := setupETagHandler()
+	page := httptest.NewRecorder()
+	th.ServeHTTP(page, mockRequest("/some/path", "text/html"))
+	fragment := httptest.NewRecorder()
+	th.ServeHTTP(fragment, mockRequest("/some/path", TemplateContentType))
+
+	pageTag, fragmentTag := page.Header().Get("ETag"), fragment.Header().Get("ETag")
+	if pageTag == fragmentTag {
+		t.Errorf("Expecting page and fragment ETags to differ, got %s", pageTag)
+	}
+
+	req := mockRequest("/some/path", TemplateContentType)
+	req.Header.Set("If-None-Match", pageTag)
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expecting a page ETag not to match the fragment, got status %d", rec.Code)
+	}
+	if got := sDumpBody(rec); got != "<template>\n<p>Hello</p>\n</template>" {
+		t.Errorf("Expecting fragment body, got %s", got)
+	}
+}
+
+func TestTemplateHandler_ETagNotSuccessful(t *testing.T) {
+	th := setupETagHandler()
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path?missing=1", "text/html"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expecting status 404, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("ETag"); got != "" {
+		t.Errorf("Expecting no ETag for an unsuccessful response, got %s", got)
+	}
+}
+
+func TestTemplateHandler_ETagsDisabled(t *testing.T) {
+	th := setupETagHandler()
+	th.ETags = false
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if got := rec.Header().Get("ETag"); got != "" {
+		t.Errorf("Expecting no ETag header, got %s", got)
+	}
+}
@@ -2,18 +2,24 @@ package treetop
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 // DeveloperExecutor wraps another executor, it will re-generate the view handler for
 // every request. This can be used to live-reload templates during development.
 //
+// Full page responses include a small script which listens for template changes and
+// merges the updated page content using the treetop client, see devHandler.ServeHTTP.
+// Change events require the wrapped executor to implement TemplateSource.
+//
 // Example:
 //
 //	exec := DeveloperExecutor{FileExecutor{}}
 //	mux.Handle("/hello", exec.NewViewHandler(v))
 //
+// Errors are logged using the Logger of the handlers created by the wrapped executor.
+//
 // Note: this is for development use only, it is not suitable for production systems
 type DeveloperExecutor struct {
 	ViewExecutor
@@ -25,11 +31,12 @@ type DeveloperExecutor struct {
 // Note: this is for development use only, it is not suitable for production systems
 func (de *DeveloperExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
 	// dry run to capture errors up front
-	_ = de.ViewExecutor.NewViewHandler(view, includes...)
+	initial := de.ViewExecutor.NewViewHandler(view, includes...)
 	return &devHandler{
-		view: view,
-		incl: includes,
-		exec: de.ViewExecutor,
+		initial: initial,
+		view:    view,
+		incl:    includes,
+		exec:    de.ViewExecutor,
 	}
 }
 
@@ -37,9 +44,12 @@ func (de *DeveloperExecutor) NewViewHandler(view *View, includes ...*View) ViewH
 type devHandler struct {
 	pageOnly     bool
 	templateOnly bool
+	methods      []string
 	view         *View
 	incl         []*View
 	exec         ViewExecutor
+	// initial is the handler created by the dry run
+	initial ViewHandler
 }
 
 // FragmentOnly creates a new Handler that only responds to fragment requests
@@ -47,9 +57,11 @@ func (h *devHandler) FragmentOnly() ViewHandler {
 	return &devHandler{
 		templateOnly: true,
 		pageOnly:     h.pageOnly,
+		methods:      h.methods,
 		view:         h.view,
 		incl:         h.incl,
 		exec:         h.exec,
+		initial:      h.initial,
 	}
 }
 
@@ -58,9 +70,25 @@ func (h *devHandler) PageOnly() ViewHandler {
 	return &devHandler{
 		pageOnly:     true,
 		templateOnly: h.templateOnly,
+		methods:      h.methods,
+		view:         h.view,
+		incl:         h.incl,
+		exec:         h.exec,
+		initial:      h.initial,
+	}
+}
+
+// AllowMethods creates a new handler that will only respond to requests with one of the
+// supplied HTTP methods
+func (h *devHandler) AllowMethods(methods ...string) ViewHandler {
+	return &devHandler{
+		pageOnly:     h.pageOnly,
+		templateOnly: h.templateOnly,
+		methods:      methods,
 		view:         h.view,
 		incl:         h.incl,
 		exec:         h.exec,
+		initial:      h.initial,
 	}
 }
 
@@ -68,8 +96,34 @@ func (h *devHandler) PageOnly() ViewHandler {
 // executor and the view definitions for each request.
 // If an error occurs a HTML page will be rendered with the details for debug purposes.
 //
+// Live reload: full page responses include a script which subscribes to template changes
+// using an EventSource for the same URL. Requests accepting "text/event-stream" are served
+// a stream of change events when the wrapped executor implements TemplateSource. The script
+// is added as the page is written, so responses that are flushed are still streamed.
+//
 // NOTE: This is intended for development, it is not suitable for production use.
 func (h *devHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case acceptsEventStream(req):
+		h.serveTemplateChanges(w, req)
+	case IsTemplateRequest(req):
+		if req.Header.Get(liveReloadHeader) != "" {
+			w = &replaceHistoryWriter{w}
+		}
+		h.serve(w, req)
+	default:
+		lw := &liveReloadWriter{ResponseWriter: w}
+		h.serve(lw, req)
+		lw.finish()
+	}
+}
+
+// serve will build and execute the view handler for a request
+func (h *devHandler) serve(w http.ResponseWriter, req *http.Request) {
+	if ce, ok := h.exec.(CachingExecutor); ok && ce.TemplateCache() != nil {
+		// force all templates to be reloaded
+		ce.TemplateCache().Invalidate()
+	}
 	handler := h.exec.NewViewHandler(h.view, h.incl...)
 	errs := h.exec.FlushErrors()
 	if len(errs) > 0 {
@@ -85,10 +139,17 @@ func (h *devHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if h.templateOnly {
 		handler = handler.FragmentOnly()
 	}
+	if len(h.methods) > 0 {
+		handler = handler.AllowMethods(h.methods...)
+	}
 
 	if th, ok := handler.(*TemplateHandler); ok && th.ServeTemplateError == nil {
 		th.ServeTemplateError = func(err error, resp Response, req *http.Request) {
-			log.Printf("DeveloperExecutor error: %s", err)
+			view := th.Page
+			if IsTemplateRequest(req) {
+				view = th.Partial
+			}
+			th.logResponse(slog.LevelError, "DeveloperExecutor error", resp, req, view, err)
 			if status := resp.Status(0); status > 0 {
 				resp.WriteHeader(status)
 			} else {
@@ -137,6 +198,11 @@ func init() {
 		<h3>Errors:</h3>
 		<pre><code>{{ .Output }}</code></pre>
 
+		{{ if .Stack }}
+		<h3>Stack:</h3>
+		<pre><code>{{ .Stack }}</code></pre>
+		{{ end }}
+
 		{{ if .PageView }}
 		<h3>Page View:</h3>
 		<pre><code>{{ .PageView }}</code></pre>
@@ -161,11 +227,13 @@ func init() {
 func writeDebugErrorPage(w http.ResponseWriter, handler ViewHandler, err error) error {
 	errData := struct {
 		Output       string
+		Stack        string
 		PageView     string
 		TemplateView string
 		Includes     []string
 	}{
 		Output: err.Error(),
+		Stack:  panicStack(err),
 	}
 	if th, ok := handler.(*TemplateHandler); ok {
 		errData.PageView = SprintViewTree(th.Page)
@@ -197,3 +197,7 @@ func (te *testExec) FragmentOnly() ViewHandler {
 func (te *testExec) PageOnly() ViewHandler {
 	return te
 }
+
+func (te *testExec) AllowMethods(...string) ViewHandler {
+	return te
+}
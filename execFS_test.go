@@ -0,0 +1,137 @@
+package treetop
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSExecutor_NewViewHandler(t *testing.T) {
+	base := NewView("base.html", Constant(struct {
+		Content interface{}
+		PS      interface{}
+	}{
+		Content: struct {
+			Message string
+			Sub     interface{}
+		}{
+			Message: "from base to content",
+			Sub:     "from base via content to sub",
+		},
+		PS: "from base to ps",
+	}))
+	content := base.NewSubView("content", "content.html", Constant(struct {
+		Message string
+		Sub     interface{}
+	}{
+		Message: "from content to content!",
+		Sub:     "from content to sub",
+	}))
+	content.NewDefaultSubView("sub", "sub.html", Constant("from sub to sub"))
+	ps := base.NewSubView("ps", "ps.html", Constant("from ps to ps"))
+
+	expectPage := stripIndent(`<html>
+	<body>
+	<div id="content">
+	<p>Given from base to content</p>
+	<p id="sub">Given from base via content to sub</p>
+	</div>
+
+	<div id="ps">Given from base to ps</div>
+	</body>
+	</html>`)
+	expectTemplate := stripIndent(`<template>
+	<div id="content">
+	<p>Given from content to content!</p>
+	<p id="sub">Given from content to sub</p>
+	</div>
+	<div id="ps">Given from ps to ps</div>
+	</template>`)
+
+	tests := []struct {
+		name string
+		exec *FSExecutor
+	}{
+		{
+			name: "dir FS",
+			exec: &FSExecutor{FS: os.DirFS("testdata")},
+		},
+		{
+			name: "with root",
+			exec: &FSExecutor{FS: os.DirFS("."), Root: "testdata"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.exec.NewViewHandler(content, ps)
+			if errs := tt.exec.FlushErrors(); len(errs) > 0 {
+				t.Fatal("Unexpected executor errors\n", errs)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+			if gotPage := stripIndent(sDumpBody(rec)); gotPage != expectPage {
+				t.Errorf("Expecting page body\n%s\nGot\n%s", expectPage, gotPage)
+			}
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+			if gotTemplate := stripIndent(sDumpBody(rec)); gotTemplate != expectTemplate {
+				t.Errorf("Expecting partial body\n%s\nGot\n%s", expectTemplate, gotTemplate)
+			}
+		})
+	}
+}
+
+func TestFSExecutor_NotExist(t *testing.T) {
+	exec := &FSExecutor{
+		FS: fstest.MapFS{
+			"templates/base.html": {Data: []byte(`<div>{{ template "content" .Content }}</div>`)},
+		},
+		Root: "templates",
+	}
+	base := NewView("base.html", Noop)
+	content := base.NewDefaultSubView("content", "content.html", Noop)
+	exec.NewViewHandler(base)
+
+	errs := exec.FlushErrors()
+	if len(errs) != 2 {
+		t.Fatalf("Expecting an error for page and partial, got %d errors\n%s", len(errs), errs)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expecting a not exist error, got %s", err)
+		}
+		if err.View == nil || err.View.Template != content.Template {
+			t.Errorf("Expecting the error to reference the content view, got %s", SprintViewInfo(err.View))
+		}
+		expect := `failed to load template "content.html": failed to read template file 'templates/content.html': open templates/content.html: file does not exist`
+		if got := err.Error(); got != expect {
+			t.Errorf("Expecting error\n%s\ngot\n%s", expect, got)
+		}
+	}
+}
+
+func TestFSExecutor_KeyedString(t *testing.T) {
+	exec := FSExecutor{
+		FS: os.DirFS("testdata"),
+		KeyedString: map[string]string{
+			"local://titles.html": `<h1>{{ . }}</h1>`,
+		},
+	}
+	v := NewView("local://titles.html", Constant("Test Title"))
+	h := exec.NewViewHandler(v)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if gotPage := strings.TrimSpace(sDumpBody(rec)); gotPage != "<h1>Test Title</h1>" {
+		t.Errorf("Expecting keyed string template, got\n%s", gotPage)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expecting status 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,339 @@
+package treetop
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReloadExecutor wraps another executor and polls the template files referenced by
+// each view handler for changes. Only handlers that reference a modified template
+// are rebuilt.
+//
+// If a rebuild fails, the last good handler will continue to be used. The outstanding
+// errors can be displayed on a debug page by binding the executor itself as a HTTP handler.
+//
+// Example:
+//
+//	exec := &treetop.ReloadExecutor{ViewExecutor: &treetop.FileExecutor{}}
+//	mux.Handle("/hello", exec.NewViewHandler(v))
+//	mux.Handle("/debug/treetop", exec)
+//	go exec.Watch(ctx)
+//
+// The wrapped executor must implement the TemplateSource interface for changes to be detected.
+//
+// Note: this is for development use only, it is not suitable for production systems
+type ReloadExecutor struct {
+	ViewExecutor
+	// Interval between polling template files for changes, default is one second
+	Interval time.Duration
+	// Logger is used to report errors rebuilding handlers, the slog default logger is used when nil
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	captured CaptureErrors
+	handlers []*reloadState
+}
+
+// reloadState is the most recent handler built for an endpoint
+type reloadState struct {
+	view *View
+	incl []*View
+
+	mu      sync.RWMutex
+	handler ViewHandler
+	good    bool
+	errs    ExecutorErrors
+	hashes  map[string]uint64
+}
+
+// NewViewHandler creates a handler for a view endpoint which will be
+// rebuilt when a template file changes.
+func (re *ReloadExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	state := &reloadState{
+		view: view,
+		incl: includes,
+	}
+	state.hashes = re.hashTemplates(state.templatePaths())
+	state.handler = re.ViewExecutor.NewViewHandler(view, includes...)
+	state.errs = re.ViewExecutor.FlushErrors()
+	state.good = len(state.errs) == 0
+	re.captured.AddErrors(state.errs)
+	re.handlers = append(re.handlers, state)
+	return &reloadHandler{state: state}
+}
+
+// FlushErrors will return the list of template creation errors that occurred
+// while ViewHandlers were being created, since the last time it was called.
+func (re *ReloadExecutor) FlushErrors() ExecutorErrors {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	return re.captured.FlushErrors()
+}
+
+// Errors returns the errors of all handlers where the most recent build has failed
+func (re *ReloadExecutor) Errors() ExecutorErrors {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	var errs ExecutorErrors
+	for _, state := range re.handlers {
+		state.mu.RLock()
+		errs = append(errs, state.errs...)
+		state.mu.RUnlock()
+	}
+	return errs
+}
+
+// Watch will poll template files for changes at the configured interval
+// until the context is cancelled.
+func (re *ReloadExecutor) Watch(ctx context.Context) {
+	interval := re.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			re.Poll()
+		}
+	}
+}
+
+// Poll checks the templates of all handlers for changes and rebuilds the
+// handlers affected. The paths of modified templates are returned.
+func (re *ReloadExecutor) Poll() []string {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	var paths []string
+	{
+		seen := make(map[string]bool)
+		for _, state := range re.handlers {
+			for path := range state.hashes {
+				if !seen[path] {
+					seen[path] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	hashes := re.hashTemplates(paths)
+
+	var (
+		changed  []string
+		affected []*reloadState
+	)
+	{
+		seen := make(map[string]bool)
+		for _, state := range re.handlers {
+			var modified bool
+			for path, hash := range state.hashes {
+				if hashes[path] == hash {
+					continue
+				}
+				modified = true
+				if !seen[path] {
+					seen[path] = true
+					changed = append(changed, path)
+				}
+			}
+			if modified {
+				affected = append(affected, state)
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	if ce, ok := re.ViewExecutor.(CachingExecutor); ok && ce.TemplateCache() != nil {
+		ce.TemplateCache().Invalidate(changed...)
+	}
+	for _, state := range affected {
+		re.rebuild(state)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// rebuild will create a new handler for an endpoint, if this fails
+// the last good handler is kept
+func (re *ReloadExecutor) rebuild(state *reloadState) {
+	hashes := re.hashTemplates(state.templatePaths())
+	handler := re.ViewExecutor.NewViewHandler(state.view, state.incl...)
+	errs := re.ViewExecutor.FlushErrors()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.hashes = hashes
+	state.errs = errs
+	if len(errs) > 0 {
+		re.logger().Error("ReloadExecutor error",
+			slog.String("template", state.view.Template),
+			slog.String("defines", state.view.Defines),
+			slog.Any("error", errs),
+		)
+		if state.good {
+			return
+		}
+	}
+	state.handler = handler
+	state.good = len(errs) == 0
+}
+
+// logger returns the configured logger or the slog default logger
+func (re *ReloadExecutor) logger() *slog.Logger {
+	if re.Logger != nil {
+		return re.Logger
+	}
+	return slog.Default()
+}
+
+// hashTemplates computes a hash of the content for each template path
+func (re *ReloadExecutor) hashTemplates(paths []string) map[string]uint64 {
+	source, ok := re.ViewExecutor.(TemplateSource)
+	if !ok {
+		return make(map[string]uint64)
+	}
+	return hashTemplateSources(source, paths)
+}
+
+// ServeHTTP will render a debug page with the outstanding template errors
+func (re *ReloadExecutor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	errs := re.Errors()
+	if len(errs) == 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("No template errors\n"))
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	if err := writeDebugErrorPage(w, nil, errs); err != nil {
+		panic(err)
+	}
+}
+
+// templatePaths lists the template of every view reachable from the endpoint
+func (state *reloadState) templatePaths() []string {
+	return listTemplatePaths(state.view, state.incl...)
+}
+
+// listTemplatePaths will compile the views of an endpoint and list the template and
+// error template of every view reachable from the page, partial and postscript views
+func listTemplatePaths(view *View, includes ...*View) []string {
+	includes = append([]*View(nil), includes...)
+	page, part, postscript := CompileViews(view, includes...)
+	seen := make(map[string]bool)
+	var paths []string
+	queue := viewQueue{}
+	for _, v := range append([]*View{page, part}, postscript...) {
+		if v != nil {
+			queue.add(v)
+		}
+	}
+	for !queue.empty() {
+		v, _ := queue.next()
+		for _, path := range []string{v.Template, v.ErrorTemplate} {
+			if path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+		for _, sub := range v.SubViews {
+			if sub != nil {
+				queue.add(sub)
+			}
+		}
+	}
+	return paths
+}
+
+// hashTemplateSources computes a hash of the content for each template path,
+// an error loading a template is treated as content
+func hashTemplateSources(source TemplateSource, paths []string) map[string]uint64 {
+	hashes := make(map[string]uint64, len(paths))
+	for _, path := range paths {
+		h := fnv.New64a()
+		tmpl, err := source.LoadTemplate(path)
+		if err != nil {
+			h.Write([]byte("error: " + err.Error()))
+		} else {
+			h.Write([]byte(tmpl))
+		}
+		hashes[path] = h.Sum64()
+	}
+	return hashes
+}
+
+// reloadHandler serves requests using the current handler of an endpoint
+type reloadHandler struct {
+	pageOnly     bool
+	templateOnly bool
+	methods      []string
+	state        *reloadState
+}
+
+// FragmentOnly creates a new Handler that only responds to fragment requests
+func (h *reloadHandler) FragmentOnly() ViewHandler {
+	return &reloadHandler{
+		templateOnly: true,
+		pageOnly:     h.pageOnly,
+		methods:      h.methods,
+		state:        h.state,
+	}
+}
+
+// PageOnly create a new handler that will only respond to non-fragment (full page) requests
+func (h *reloadHandler) PageOnly() ViewHandler {
+	return &reloadHandler{
+		pageOnly:     true,
+		templateOnly: h.templateOnly,
+		methods:      h.methods,
+		state:        h.state,
+	}
+}
+
+// AllowMethods creates a new handler that will only respond to requests with one of the
+// supplied HTTP methods
+func (h *reloadHandler) AllowMethods(methods ...string) ViewHandler {
+	return &reloadHandler{
+		pageOnly:     h.pageOnly,
+		templateOnly: h.templateOnly,
+		methods:      methods,
+		state:        h.state,
+	}
+}
+
+// ServeHTTP will delegate to the last good handler of the endpoint. If a handler has not been
+// built successfully a HTML page will be rendered with the error details for debug purposes.
+func (h *reloadHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.state.mu.RLock()
+	handler, good, errs := h.state.handler, h.state.good, h.state.errs
+	h.state.mu.RUnlock()
+
+	if !good {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := writeDebugErrorPage(w, handler, errs); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if h.pageOnly {
+		handler = handler.PageOnly()
+	}
+	if h.templateOnly {
+		handler = handler.FragmentOnly()
+	}
+	if len(h.methods) > 0 {
+		handler = handler.AllowMethods(h.methods...)
+	}
+	handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,148 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReloadExecutor_Poll(t *testing.T) {
+	keyed := NewKeyedStringExecutor(map[string]string{
+		"base.html": `<div>{{ template "content" . }}</div>`,
+		"a.html":    `<p>A {{ . }}</p>`,
+		"b.html":    `<p>B {{ . }}</p>`,
+	})
+	exec := &ReloadExecutor{ViewExecutor: keyed}
+	base := NewView("base.html", Delegate("content"))
+	a := base.NewSubView("content", "a.html", Constant("a!!"))
+	b := base.NewSubView("content", "b.html", Constant("b!!"))
+	handlerA := exec.NewViewHandler(a)
+	handlerB := exec.NewViewHandler(b)
+	if errs := exec.FlushErrors(); len(errs) != 0 {
+		t.Fatal("Template errors", errs)
+	}
+	before := handlerB.(*reloadHandler).state.handler
+
+	if changed := exec.Poll(); len(changed) != 0 {
+		t.Errorf("Expecting no changes, got %v", changed)
+	}
+
+	keyed.Templates["a.html"] = `<p>Updated A {{ . }}</p>`
+	if changed := exec.Poll(); !reflect.DeepEqual(changed, []string{"a.html"}) {
+		t.Errorf("Expecting a.html to have changed, got %v", changed)
+	}
+	if after := handlerB.(*reloadHandler).state.handler; after != before {
+		t.Error("Expecting handler B not to be rebuilt")
+	}
+
+	rec := httptest.NewRecorder()
+	handlerA.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<div><p>Updated A a!!</p></div>` {
+		t.Errorf("Expecting updated template for handler A, got %s", got)
+	}
+
+	keyed.Templates["base.html"] = `<section>{{ template "content" . }}</section>`
+	if changed := exec.Poll(); !reflect.DeepEqual(changed, []string{"base.html"}) {
+		t.Errorf("Expecting base.html to have changed, got %v", changed)
+	}
+	rec = httptest.NewRecorder()
+	handlerB.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<section><p>B b!!</p></section>` {
+		t.Errorf("Expecting updated template for handler B, got %s", got)
+	}
+}
+
+func TestReloadExecutor_KeepLastGoodHandler(t *testing.T) {
+	keyed := NewKeyedStringExecutor(map[string]string{
+		"test.html": `<p>Before {{ . }}</p>`,
+	})
+	exec := &ReloadExecutor{ViewExecutor: keyed}
+	handler := exec.NewViewHandler(NewView("test.html", Constant("data"))).PageOnly()
+
+	keyed.Templates["test.html"] = `<p>Broken {{ .</p>`
+	exec.Poll()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<p>Before data</p>` {
+		t.Errorf("Expecting last good handler to be used, got %s", got)
+	}
+	errs := exec.Errors()
+	if len(errs) != 2 {
+		t.Fatalf("Expecting page and partial errors, got %v", errs)
+	}
+
+	rec = httptest.NewRecorder()
+	exec.ServeHTTP(rec, mockRequest("/debug", "*/*"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting debug page status 500, got %d", rec.Code)
+	}
+	if got := sDumpBody(rec); !strings.Contains(got, `failed to parse template &#34;test.html&#34;`) {
+		t.Errorf("Expecting debug page to show the template error, got %s", got)
+	}
+
+	keyed.Templates["test.html"] = `<p>Fixed {{ . }}</p>`
+	exec.Poll()
+	if errs := exec.Errors(); len(errs) != 0 {
+		t.Errorf("Expecting errors to be resolved, got %v", errs)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<p>Fixed data</p>` {
+		t.Errorf("Expecting fixed template, got %s", got)
+	}
+}
+
+func TestReloadExecutor_InitialErrors(t *testing.T) {
+	keyed := NewKeyedStringExecutor(map[string]string{})
+	exec := &ReloadExecutor{ViewExecutor: keyed}
+	handler := exec.NewViewHandler(NewView("test.html", Constant("data")))
+	if errs := exec.FlushErrors(); len(errs) == 0 {
+		t.Error("Expecting template errors to be captured")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status 500, got %d", rec.Code)
+	}
+	if got := sDumpBody(rec); !strings.Contains(got, "no key found for template &#39;test.html&#39;") {
+		t.Errorf("Expecting debug page with template error, got %s", got)
+	}
+
+	keyed.Templates["test.html"] = `<p>Hello {{ . }}</p>`
+	if changed := exec.Poll(); !reflect.DeepEqual(changed, []string{"test.html"}) {
+		t.Errorf("Expecting test.html to have changed, got %v", changed)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<p>Hello data</p>` {
+		t.Errorf("Expecting handler to be rebuilt, got %s", got)
+	}
+}
+
+func TestReloadExecutor_PollErrorTemplate(t *testing.T) {
+	base, _ := setupErrorBoundary()
+	keyed := NewKeyedStringExecutor(map[string]string{})
+	for name, tmpl := range errorBoundaryTemplates {
+		keyed.Templates[name] = tmpl
+	}
+	exec := &ReloadExecutor{ViewExecutor: keyed}
+	handler := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) != 0 {
+		t.Fatal("Template errors", errs)
+	}
+
+	keyed.Templates["comments-error.html"] = `<div id="comments">Try again later</div>`
+	if changed := exec.Poll(); !reflect.DeepEqual(changed, []string{"comments-error.html"}) {
+		t.Errorf("Expecting comments-error.html to have changed, got %v", changed)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	expect := `<main><p id="content">Hello</p></main><aside><div id="comments">Try again later</div></aside>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
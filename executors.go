@@ -1,11 +1,15 @@
 package treetop
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 )
 
 // ViewExecutor is an interface for objects that implement transforming a View definition
@@ -15,6 +19,12 @@ type ViewExecutor interface {
 	FlushErrors() ExecutorErrors
 }
 
+// TemplateSource is implemented by executors which load template strings
+// from a view template path or key. It allows changes to templates to be detected.
+type TemplateSource interface {
+	LoadTemplate(string) (string, error)
+}
+
 // ExecutorErrors is a list zero or more template errors created when parsing
 // templates
 type ExecutorErrors []*ExecutorError
@@ -43,6 +53,27 @@ func (te *ExecutorError) Error() string {
 	return te.Err.Error()
 }
 
+// Unwrap returns the underlying error
+func (te *ExecutorError) Unwrap() error {
+	if te == nil {
+		return nil
+	}
+	return te.Err
+}
+
+// newExecutorError will associate an error with a view, unless the error
+// already references the view in the hierarchy that was responsible
+func newExecutorError(view *View, err error) *ExecutorError {
+	var execErr *ExecutorError
+	if errors.As(err, &execErr) {
+		return execErr
+	}
+	return &ExecutorError{
+		View: view,
+		Err:  err,
+	}
+}
+
 // CaptureErrors is a base type for implementing concreate view executors
 type CaptureErrors struct {
 	Errors ExecutorErrors
@@ -65,6 +96,7 @@ func (ce *CaptureErrors) AddErrors(errs ExecutorErrors) {
 }
 
 // StringExecutor loads view templates as an inline template string.
+// The optional Logger is used by the handlers created to report errors.
 //
 // Example:
 //
@@ -73,7 +105,8 @@ func (ce *CaptureErrors) AddErrors(errs ExecutorErrors) {
 //	mux.Handle("/hello", exec.NewViewHandler(v))
 type StringExecutor struct {
 	CaptureErrors
-	Funcs template.FuncMap
+	Funcs  template.FuncMap
+	Logger *slog.Logger
 }
 
 // NewViewHandler creates a ViewHandler from a View endpoint definition treating
@@ -83,6 +116,7 @@ func (se *StringExecutor) NewViewHandler(view *View, includes ...*View) ViewHand
 		return tmpl, nil
 	})
 	handler, errs := NewTemplateHandler(view, includes, loader)
+	handler.Logger = se.Logger
 	se.AddErrors(errs)
 	return handler
 }
@@ -90,10 +124,12 @@ func (se *StringExecutor) NewViewHandler(view *View, includes ...*View) ViewHand
 // KeyedStringExecutor builds handlers templates from a map
 // of available templates. The view templates are treated as
 // keys into the map for the purpose of build handlers.
+// The optional Logger is used by the handlers created to report errors.
 type KeyedStringExecutor struct {
 	CaptureErrors
 	Templates map[string]string
 	Funcs     template.FuncMap
+	Logger    *slog.Logger
 }
 
 // NewKeyedStringExecutor is a deprecated method for constructing an
@@ -111,92 +147,190 @@ func NewKeyedStringExecutor(templates map[string]string) *KeyedStringExecutor {
 // NewViewHandler creates a ViewHandler from a View endpoint definition treating
 // view template strings as keys into the string template dictionary.
 func (ks *KeyedStringExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
-	loader := NewTemplateLoader(ks.Funcs, func(key string) (string, error) {
-		tmpl, ok := ks.Templates[key]
-		if !ok {
-			return "", fmt.Errorf("no key found for template '%s'", key)
-		}
-		return tmpl, nil
-	})
+	loader := NewTemplateLoader(ks.Funcs, ks.LoadTemplate)
 	handler, errs := NewTemplateHandler(view, includes, loader)
+	handler.Logger = ks.Logger
 	ks.AddErrors(errs)
 	return handler
 }
 
+// LoadTemplate will obtain the template string for a key from the template map
+func (ks *KeyedStringExecutor) LoadTemplate(key string) (string, error) {
+	tmpl, ok := ks.Templates[key]
+	if !ok {
+		return "", fmt.Errorf("no key found for template '%s'", key)
+	}
+	return tmpl, nil
+}
+
 // FileExecutor loads view templates as a path from a template file.
+//
+// An optional Cache can be supplied so that templates shared between
+// handlers are loaded and parsed once. The optional Logger is used by the handlers
+// created to report errors.
 type FileExecutor struct {
 	CaptureErrors
 	Funcs       template.FuncMap
 	KeyedString map[string]string
+	Cache       *TemplateCache
+	Logger      *slog.Logger
+}
+
+// TemplateCache returns the template cache used by this executor, if any
+func (fe *FileExecutor) TemplateCache() *TemplateCache {
+	return fe.Cache
 }
 
 // NewViewHandler creates a ViewHandler from a View endpoint definition treating
 // view template strings as a file path using os.Open.
 func (fe *FileExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
-	loader := NewTemplateLoader(fe.Funcs, func(name string) (string, error) {
-		if len(fe.KeyedString) > 0 {
-			tmpl, ok := fe.KeyedString[name]
-			if ok {
-				return tmpl, nil
-			}
-		}
-		file, err := os.Open(name)
-		if err != nil {
-			return "", err
-		}
-		defer file.Close()
-		tpl, err := ioutil.ReadAll(file)
-		if err != nil {
-			return "", err
-		}
-		return string(tpl), nil
-	})
+	loader := NewTemplateLoader(fe.Funcs, fe.LoadTemplate)
+	loader.Cache = fe.Cache
 	handler, errs := NewTemplateHandler(view, includes, loader)
+	handler.Logger = fe.Logger
 	fe.AddErrors(errs)
 	return handler
 }
 
+// LoadTemplate will obtain the template string for a file path
+func (fe *FileExecutor) LoadTemplate(name string) (string, error) {
+	if len(fe.KeyedString) > 0 {
+		tmpl, ok := fe.KeyedString[name]
+		if ok {
+			return tmpl, nil
+		}
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	tpl, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return string(tpl), nil
+}
+
 // FileSystemExecutor loads view templates as a path from a Go HTML template file.
 // The underlying file system is abstracted through the http.FileSystem interface to allow for
 // in-memory use.
 //
 // The optional KeyedString map will be checked before the loader attempts to use the FS
-// instance when obtain a template string
+// instance when obtain a template string. An optional Cache can be supplied so that templates
+// shared between handlers are loaded and parsed once. The optional Logger is used by the
+// handlers created to report errors.
 type FileSystemExecutor struct {
 	CaptureErrors
 	FS          http.FileSystem
 	Funcs       template.FuncMap
 	KeyedString map[string]string
+	Cache       *TemplateCache
+	Logger      *slog.Logger
+}
+
+// TemplateCache returns the template cache used by this executor, if any
+func (fse *FileSystemExecutor) TemplateCache() *TemplateCache {
+	return fse.Cache
 }
 
 // NewViewHandler creates a ViewHandler from a View endpoint definition treating
 // view template strings as keys into the string template dictionary.
 func (fse *FileSystemExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
-	loader := NewTemplateLoader(fse.Funcs, func(name string) (string, error) {
-		if len(fse.KeyedString) > 0 {
-			tmpl, ok := fse.KeyedString[name]
-			if ok {
-				return tmpl, nil
-			}
-		}
-		file, err := fse.FS.Open(name)
-		if err != nil {
-			return "", fmt.Errorf(
-				"failed to open template file '%s', error %s",
-				name, err.Error(),
-			)
-		}
-		defer file.Close()
-		tpl, err := ioutil.ReadAll(file)
-		if err != nil {
-			return "", fmt.Errorf(
-				"failed to open template file '%s', error %s",
-				name, err.Error(),
-			)
+	loader := NewTemplateLoader(fse.Funcs, fse.LoadTemplate)
+	loader.Cache = fse.Cache
+	handler, errs := NewTemplateHandler(view, includes, loader)
+	handler.Logger = fse.Logger
+	fse.AddErrors(errs)
+	return handler
+}
+
+// LoadTemplate will obtain the template string for a path using the file system
+func (fse *FileSystemExecutor) LoadTemplate(name string) (string, error) {
+	if len(fse.KeyedString) > 0 {
+		tmpl, ok := fse.KeyedString[name]
+		if ok {
+			return tmpl, nil
 		}
-		return string(tpl), nil
-	})
+	}
+	file, err := fse.FS.Open(name)
+	if err != nil {
+		return "", fmt.Errorf(
+			"failed to open template file '%s', error %s",
+			name, err.Error(),
+		)
+	}
+	defer file.Close()
+	tpl, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf(
+			"failed to open template file '%s', error %s",
+			name, err.Error(),
+		)
+	}
+	return string(tpl), nil
+}
+
+// FSExecutor loads view templates as a path from an io/fs file system, for example
+// an embed.FS. View template paths are resolved relative to the Root directory of the FS
+// when it is specified.
+//
+// The optional KeyedString map will be checked before the loader attempts to use the FS
+// instance when obtain a template string. An optional Cache can be supplied so that templates
+// shared between handlers are loaded and parsed once. The optional Logger is used by the
+// handlers created to report errors.
+//
+// Example:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	exec := treetop.FSExecutor{FS: templates, Root: "templates"}
+//	mux.Handle("/hello", exec.NewViewHandler(treetop.NewView("hello.html", Noop)))
+type FSExecutor struct {
+	CaptureErrors
+	FS          fs.FS
+	Root        string
+	Funcs       template.FuncMap
+	KeyedString map[string]string
+	Cache       *TemplateCache
+	Logger      *slog.Logger
+}
+
+// TemplateCache returns the template cache used by this executor, if any
+func (fse *FSExecutor) TemplateCache() *TemplateCache {
+	return fse.Cache
+}
+
+// NewViewHandler creates a ViewHandler from a View endpoint definition treating
+// view template strings as a path within the file system.
+//
+// Errors reading a template file will wrap the fs error, so that
+// errors.Is(err, fs.ErrNotExist) can be used to detect a missing template.
+func (fse *FSExecutor) NewViewHandler(view *View, includes ...*View) ViewHandler {
+	loader := NewTemplateLoader(fse.Funcs, fse.LoadTemplate)
+	loader.Cache = fse.Cache
 	handler, errs := NewTemplateHandler(view, includes, loader)
+	handler.Logger = fse.Logger
 	fse.AddErrors(errs)
 	return handler
 }
+
+// LoadTemplate will obtain the template string for a path relative to the
+// root of the file system
+func (fse *FSExecutor) LoadTemplate(name string) (string, error) {
+	if len(fse.KeyedString) > 0 {
+		tmpl, ok := fse.KeyedString[name]
+		if ok {
+			return tmpl, nil
+		}
+	}
+	if fse.Root != "" {
+		name = path.Join(fse.Root, name)
+	}
+	tpl, err := fs.ReadFile(fse.FS, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template file '%s': %w", name, err)
+	}
+	return string(tpl), nil
+}
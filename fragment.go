@@ -0,0 +1,357 @@
+package treetop
+
+import (
+	"container/list"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// name of the template function used to render a view with a cache policy
+const fragmentFuncName = "treetopFragment"
+
+// the original template of a cached view is renamed with this suffix, the view template
+// is redefined to render the fragment using the cache
+const fragmentTemplateSuffix = ":fragment"
+
+// CachePolicy enables the rendered HTML of a sub view to be cached, see View.Cache.
+//
+// When a cached fragment is available for a request, the handler of the view and those of
+// its sub views are not executed, and the HTML is inserted into the page or fragment response
+// in place of the view template. Headers, status and page URL set by the handlers of a
+// cached view will not be applied to responses served from the cache.
+//
+// The data returned by HandleSubView for a cached view should only be passed to the template
+// of the view, it cannot be inspected by the parent handler. For this reason a cache policy
+// cannot be used with a view that has a data type, see NewTypedView and View.DeclareData.
+//
+// Example:
+//
+//	nav := base.NewDefaultSubView("nav", "nav.html", navHandler)
+//	nav.Cache = &treetop.CachePolicy{
+//		Name: "nav",
+//		TTL:  5 * time.Minute,
+//		Key: func(req *http.Request) string {
+//			return req.URL.Path
+//		},
+//	}
+type CachePolicy struct {
+	// Name identifies the fragments of the policy in the store. The templates, block names
+	// and handler functions of the view hierarchy are part of the key already, a name is
+	// needed to separate views which only differ by the data of a handler closure
+	Name string
+	// TTL is the duration a rendered fragment will be reused for
+	TTL time.Duration
+	// Key derives the cache key from the request. The name and the view hierarchy of the
+	// policy are part of the key already, when Key is nil the same fragment is used
+	// for all requests
+	Key func(*http.Request) string
+	// Store holds the rendered fragments, DefaultFragmentStore is used when nil
+	Store FragmentStore
+}
+
+// FragmentStore is the interface for storing rendered view fragments,
+// it must be safe for concurrent use.
+type FragmentStore interface {
+	// Get returns the HTML for a key, false is returned if there is no entry or it has expired
+	Get(key string) ([]byte, bool)
+	// Set will store the HTML for a key, to be expired after the TTL has passed
+	Set(key string, html []byte, ttl time.Duration)
+}
+
+// DefaultFragmentStore is the in-memory store used by cache policies without a store
+var DefaultFragmentStore FragmentStore = NewFragmentLRU(1024)
+
+// FragmentLRU is an in-memory FragmentStore. The least recently used entry is evicted
+// when the capacity is exceeded.
+type FragmentLRU struct {
+	mu       sync.Mutex
+	capacity int
+	entries  *list.List
+	index    map[string]*list.Element
+	now      func() time.Time
+}
+
+// fragmentEntry is an element of the LRU list
+type fragmentEntry struct {
+	key     string
+	html    []byte
+	expires time.Time
+}
+
+// NewFragmentLRU creates an in-memory store with a maximum number of entries
+func NewFragmentLRU(capacity int) *FragmentLRU {
+	return &FragmentLRU{
+		capacity: capacity,
+		entries:  list.New(),
+		index:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get implements FragmentStore
+func (lru *FragmentLRU) Get(key string) ([]byte, bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	el, ok := lru.index[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*fragmentEntry)
+	if !lru.now().Before(entry.expires) {
+		lru.entries.Remove(el)
+		delete(lru.index, key)
+		return nil, false
+	}
+	lru.entries.MoveToFront(el)
+	return entry.html, true
+}
+
+// Set implements FragmentStore
+func (lru *FragmentLRU) Set(key string, html []byte, ttl time.Duration) {
+	if ttl <= 0 || lru.capacity <= 0 {
+		return
+	}
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	expires := lru.now().Add(ttl)
+	if el, ok := lru.index[key]; ok {
+		entry := el.Value.(*fragmentEntry)
+		entry.html, entry.expires = html, expires
+		lru.entries.MoveToFront(el)
+		return
+	}
+	lru.index[key] = lru.entries.PushFront(&fragmentEntry{
+		key:     key,
+		html:    html,
+		expires: expires,
+	})
+	for lru.entries.Len() > lru.capacity {
+		oldest := lru.entries.Back()
+		lru.entries.Remove(oldest)
+		delete(lru.index, oldest.Value.(*fragmentEntry).key)
+	}
+}
+
+// Len returns the number of entries in the store, including those which have expired
+func (lru *FragmentLRU) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.entries.Len()
+}
+
+// Purge removes all entries from the store
+func (lru *FragmentLRU) Purge() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.entries.Init()
+	lru.index = make(map[string]*list.Element)
+}
+
+// isCached returns true if the rendered view can be cached, the root view of
+// a page cannot be cached
+func isCached(v *View) bool {
+	return v != nil && v.Cache != nil && v.Defines != ""
+}
+
+// store returns the fragment store of the policy
+func (cp *CachePolicy) store() FragmentStore {
+	if cp.Store != nil {
+		return cp.Store
+	}
+	return DefaultFragmentStore
+}
+
+// fragmentKey is the store key for a view fragment. The prefix is the fragment ID of the view,
+// it is computed when the handler is built, see fragmentID.
+func fragmentKey(prefix string, v *View, req *http.Request) string {
+	if v.Cache.Key == nil {
+		return prefix
+	}
+	return prefix + "\x00" + v.Cache.Key(req)
+}
+
+// fragmentID identifies the fragments of a cached view in the store using the policy name. Since
+// the same view can be rendered with different sub views, the templates and handlers of the view
+// hierarchy are also part of the ID.
+func fragmentID(v *View) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "treetop:%q:", v.Cache.Name)
+	writeViewSignature(&sb, v)
+	return sb.String()
+}
+
+// fragmentIDs computes the ID of every cached view in the hierarchies of an endpoint
+func fragmentIDs(views ...*View) map[*View]string {
+	ids := make(map[*View]string)
+	queue := append([]*View{}, views...)
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if v == nil {
+			continue
+		}
+		if _, ok := ids[v]; ok {
+			continue
+		}
+		if isCached(v) {
+			ids[v] = fragmentID(v)
+		}
+		for _, sub := range v.SubViews {
+			queue = append(queue, sub)
+		}
+	}
+	return ids
+}
+
+// writeViewSignature writes the block names, templates and handlers of a view hierarchy
+func writeViewSignature(sb *strings.Builder, v *View) {
+	fmt.Fprintf(sb, "%q=%q(%s)", v.Defines, v.Template, handlerName(v))
+	if len(v.SubViews) == 0 {
+		return
+	}
+	names := make([]string, 0, len(v.SubViews))
+	for name := range v.SubViews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb.WriteByte('{')
+	for _, name := range names {
+		if sub := v.SubViews[name]; sub != nil {
+			writeViewSignature(sb, sub)
+		} else {
+			fmt.Fprintf(sb, "%q=nil", name)
+		}
+		sb.WriteByte(';')
+	}
+	sb.WriteByte('}')
+}
+
+// cachedFragment is the data returned by the handler of a view with a cache policy.
+// Either the HTML was found in the store, or it holds the view data so that the HTML
+// can be recorded when the template is executed.
+type cachedFragment struct {
+	hit   bool
+	html  []byte
+	data  interface{}
+	key   string
+	store FragmentStore
+	ttl   time.Duration
+}
+
+// renderedFragments is shared by all response wrappers derived for a treetop response, fragments
+// rendered by a template are written to the store once the template has executed successfully
+type renderedFragments struct {
+	mu      sync.Mutex
+	pending []*cachedFragment
+	// ids of the cached views of the handler, see fragmentIDs
+	ids map[*View]string
+}
+
+func (rf *renderedFragments) add(frag *cachedFragment) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.pending = append(rf.pending, frag)
+}
+
+// commit will write rendered fragments to their store
+func (rf *renderedFragments) commit() {
+	if rf == nil {
+		return
+	}
+	rf.mu.Lock()
+	pending := rf.pending
+	rf.pending = nil
+	rf.mu.Unlock()
+	for _, frag := range pending {
+		if frag.html != nil {
+			frag.store.Set(frag.key, frag.html, frag.ttl)
+		}
+	}
+}
+
+// discard will drop rendered fragments without storing them,
+// used when the output of a template cannot be trusted
+func (rf *renderedFragments) discard() {
+	if rf == nil {
+		return
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.pending = nil
+}
+
+// executeCached will obtain the data for a view with a cache policy. If the view fragment is
+// found in the store, the handler is not executed.
+func (rsp *ResponseWrapper) executeCached(view *View, req *http.Request) interface{} {
+	policy := view.Cache
+	id, ok := rsp.fragments.ids[view]
+	if !ok {
+		id = fragmentID(view)
+	}
+	key := fragmentKey(id, view, req)
+	store := policy.store()
+	if html, ok := store.Get(key); ok {
+		return &cachedFragment{hit: true, html: html}
+	}
+	data := rsp.executeHandler(view, req)
+	if rsp.Finished() || rsp.status >= http.StatusMultipleChoices {
+		// only successful renders are cached
+		return data
+	}
+	frag := &cachedFragment{
+		data:  data,
+		key:   key,
+		store: store,
+		ttl:   policy.TTL,
+	}
+	rsp.fragments.add(frag)
+	return frag
+}
+
+// bindFragmentFunc adds the template function used to render cached views to a template,
+// this must be done again for each clone
+func bindFragmentFunc(t *template.Template) {
+	t.Funcs(template.FuncMap{
+		fragmentFuncName: func(name string, data interface{}) (template.HTML, error) {
+			frag, ok := data.(*cachedFragment)
+			if ok && frag.hit {
+				return template.HTML(frag.html), nil
+			}
+			if ok {
+				data = frag.data
+			}
+			buf := getBuffer()
+			defer releaseBuffer(buf)
+			if err := t.ExecuteTemplate(buf, name+fragmentTemplateSuffix, data); err != nil {
+				return "", err
+			}
+			html := buf.String()
+			if ok {
+				frag.html = []byte(html)
+			}
+			return template.HTML(html), nil
+		},
+	})
+}
+
+// defineFragment will redefine the template of a cached view so that it is rendered
+// using the fragment function, the original template is renamed
+func defineFragment(out *template.Template, v *View) error {
+	tmpl := out.Lookup(v.Defines)
+	if tmpl == nil || tmpl.Tree == nil {
+		return nil
+	}
+	if _, err := out.AddParseTree(v.Defines+fragmentTemplateSuffix, tmpl.Tree.Copy()); err != nil {
+		return err
+	}
+	_, err := out.Parse(fmt.Sprintf(
+		`{{ define %q }}{{ %s %q . }}{{ end }}`,
+		v.Defines, fragmentFuncName, v.Defines,
+	))
+	return err
+}
@@ -0,0 +1,314 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fragmentTemplates = map[string]string{
+	"base.html":      `<body>{{ template "nav" .Nav }}<main>{{ template "content" .Content }}</main></body>`,
+	"nav.html":       `<nav>{{ .Title }} {{ template "nav-items" .Items }}</nav>`,
+	"nav-items.html": `<ul>{{ range . }}<li>{{ . }}</li>{{ end }}</ul>`,
+	"content.html":   `<p>{{ . }}</p>`,
+	"nav-error.html": `<nav>unavailable</nav>`,
+}
+
+type fragmentTest struct {
+	base, nav, content *View
+	navCalls           int32
+	itemCalls          int32
+	store              *FragmentLRU
+}
+
+func setupFragmentTest() *fragmentTest {
+	ft := &fragmentTest{store: NewFragmentLRU(10)}
+	ft.base = NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Nav":     rsp.HandleSubView("nav", req),
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	ft.nav = ft.base.NewDefaultSubView("nav", "nav.html", func(rsp Response, req *http.Request) interface{} {
+		atomic.AddInt32(&ft.navCalls, 1)
+		if req.URL.Query().Get("status") != "" {
+			rsp.Status(http.StatusNotFound)
+		}
+		return map[string]interface{}{
+			"Title": "Menu " + req.URL.Query().Get("lang"),
+			"Items": rsp.HandleSubView("nav-items", req),
+		}
+	})
+	ft.nav.Cache = &CachePolicy{
+		TTL: time.Minute,
+		Key: func(req *http.Request) string {
+			return req.URL.Query().Get("lang")
+		},
+		Store: ft.store,
+	}
+	ft.nav.NewDefaultSubView("nav-items", "nav-items.html", func(rsp Response, req *http.Request) interface{} {
+		atomic.AddInt32(&ft.itemCalls, 1)
+		if req.URL.Query().Get("broken") != "" {
+			return "not a list"
+		}
+		return []string{"a", "b"}
+	})
+	ft.content = ft.base.NewDefaultSubView("content", "content.html", func(rsp Response, req *http.Request) interface{} {
+		return req.URL.Path
+	})
+	return ft
+}
+
+func (ft *fragmentTest) handler(t *testing.T, view *View) *TemplateHandler {
+	t.Helper()
+	exec := NewKeyedStringExecutor(fragmentTemplates)
+	th := exec.NewViewHandler(view).(*TemplateHandler)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return th
+}
+
+func serveFragmentTest(h http.Handler, path, accept string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, mockRequest(path, accept))
+	return rec
+}
+
+func TestFragmentCache_PageRequest(t *testing.T) {
+	ft := setupFragmentTest()
+	th := ft.handler(t, ft.content)
+
+	for i, path := range []string{"/one?lang=en", "/two?lang=en"} {
+		rec := serveFragmentTest(th, path, "text/html")
+		expect := `<body><nav>Menu en <ul><li>a</li><li>b</li></ul></nav><main><p>` + path[:4] + `</p></main></body>`
+		if got := sDumpBody(rec); got != expect {
+			t.Errorf("Request %d: expecting body\n%s\nGOT\n%s", i, expect, got)
+		}
+	}
+	if ft.navCalls != 1 || ft.itemCalls != 1 {
+		t.Errorf("Expecting nav handlers to be called once, got nav %d and items %d", ft.navCalls, ft.itemCalls)
+	}
+
+	// a different key is rendered separately
+	rec := serveFragmentTest(th, "/one?lang=fr", "text/html")
+	expect := `<body><nav>Menu fr <ul><li>a</li><li>b</li></ul></nav><main><p>/one</p></main></body>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+	if ft.navCalls != 2 || ft.store.Len() != 2 {
+		t.Errorf("Expecting two cached fragments, got %d calls and %d entries", ft.navCalls, ft.store.Len())
+	}
+}
+
+func TestFragmentCache_TemplateRequest(t *testing.T) {
+	ft := setupFragmentTest()
+	page := ft.handler(t, ft.content)
+	fragment := ft.handler(t, ft.nav)
+
+	// fragment responses and page responses share cached fragments
+	serveFragmentTest(page, "/some/path?lang=en", "text/html")
+	for i := 0; i < 2; i++ {
+		rec := serveFragmentTest(fragment, "/some/path?lang=en", TemplateContentType)
+		expect := "<template>\n<nav>Menu en <ul><li>a</li><li>b</li></ul></nav>\n</template>"
+		if got := sDumpBody(rec); got != expect {
+			t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+		}
+	}
+	if ft.navCalls != 1 {
+		t.Errorf("Expecting nav handler to be called once, got %d", ft.navCalls)
+	}
+}
+
+func TestFragmentCache_NotCached(t *testing.T) {
+	ft := setupFragmentTest()
+	th := ft.handler(t, ft.content)
+
+	// handler status
+	serveFragmentTest(th, "/some/path?lang=en&status=1", "text/html")
+	serveFragmentTest(th, "/some/path?lang=en&status=1", "text/html")
+	if ft.navCalls != 2 || ft.store.Len() != 0 {
+		t.Errorf("Expecting error status not to be cached, got %d calls and %d entries", ft.navCalls, ft.store.Len())
+	}
+
+	// template error
+	rec := serveFragmentTest(th, "/some/path?lang=en&broken=1", "text/html")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status 500, got %d", rec.Code)
+	}
+	if ft.store.Len() != 0 {
+		t.Errorf("Expecting failed template not to be cached, got %d entries", ft.store.Len())
+	}
+}
+
+func TestFragmentCache_ErrorBoundary(t *testing.T) {
+	ft := setupFragmentTest()
+	ft.nav.ErrorTemplate = "nav-error.html"
+	ft.nav.SubViews["nav-items"].ErrorTemplate = "nav-error.html"
+	th := ft.handler(t, ft.content)
+
+	rec := serveFragmentTest(th, "/some/path?lang=en&broken=1", "text/html")
+	expect := `<body><nav>Menu en <nav>unavailable</nav></nav><main><p>/some/path</p></main></body>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status 500, got %d", rec.Code)
+	}
+	if ft.store.Len() != 0 {
+		t.Errorf("Expecting error template not to be cached, got %d entries", ft.store.Len())
+	}
+}
+
+func TestFragmentCache_Concurrent(t *testing.T) {
+	ft := setupFragmentTest()
+	th := ft.handler(t, ft.content)
+	th.ConcurrentSubViews = true
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serveFragmentTest(th, "/some/path?lang=en", "text/html")
+			expect := `<body><nav>Menu en <ul><li>a</li><li>b</li></ul></nav><main><p>/some/path</p></main></body>`
+			if got := sDumpBody(rec); got != expect {
+				t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+			}
+		}()
+	}
+	wg.Wait()
+	if ft.store.Len() != 1 {
+		t.Errorf("Expecting one cached fragment, got %d", ft.store.Len())
+	}
+}
+
+func TestFragmentLRU(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	lru := NewFragmentLRU(2)
+	lru.now = func() time.Time { return now }
+
+	lru.Set("a", []byte("A"), time.Minute)
+	lru.Set("b", []byte("B"), time.Second)
+	if html, ok := lru.Get("a"); !ok || string(html) != "A" {
+		t.Errorf("Expecting entry a, got %q %v", html, ok)
+	}
+	// b is least recently used
+	lru.Set("c", []byte("C"), time.Minute)
+	if _, ok := lru.Get("b"); ok {
+		t.Error("Expecting entry b to be evicted")
+	}
+	if lru.Len() != 2 {
+		t.Errorf("Expecting 2 entries, got %d", lru.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := lru.Get("a"); ok {
+		t.Error("Expecting entry a to have expired")
+	}
+	if lru.Len() != 1 {
+		t.Errorf("Expecting expired entry to be removed, got %d entries", lru.Len())
+	}
+
+	lru.Set("d", []byte("D"), 0)
+	if _, ok := lru.Get("d"); ok {
+		t.Error("Expecting entry without a TTL not to be stored")
+	}
+	lru.Purge()
+	if lru.Len() != 0 {
+		t.Errorf("Expecting no entries after purge, got %d", lru.Len())
+	}
+}
+
+func TestFragmentKey(t *testing.T) {
+	ft := setupFragmentTest()
+	req := mockRequest("/some/path?lang=en", "text/html")
+	key := fragmentKey(fragmentID(ft.nav), ft.nav, req)
+
+	other := ft.nav.Copy()
+	other.NewDefaultSubView("nav-items", "other-items.html", Noop)
+	if fragmentKey(fragmentID(other), other, req) == key {
+		t.Error("Expecting the key to differ when the sub views differ")
+	}
+	if copied := ft.nav.Copy(); fragmentKey(fragmentID(copied), copied, req) != key {
+		t.Error("Expecting a copy of the view to have the same key")
+	}
+	if fragmentKey(fragmentID(ft.nav), ft.nav, mockRequest("/some/path?lang=fr", "text/html")) == key {
+		t.Error("Expecting the key to differ by request")
+	}
+}
+
+func TestFragmentKey_Handler(t *testing.T) {
+	req := mockRequest("/some/path", "text/html")
+	publicNav := NewSubView("nav", "nav.html", Constant("public"))
+	publicNav.Cache = &CachePolicy{Name: "public", TTL: time.Minute}
+	adminNav := NewSubView("nav", "nav.html", Constant("ADMIN NAV"))
+	adminNav.Cache = &CachePolicy{Name: "admin", TTL: time.Minute}
+	if fragmentKey(fragmentID(publicNav), publicNav, req) == fragmentKey(fragmentID(adminNav), adminNav, req) {
+		t.Error("Expecting views with a different policy name to have a different key")
+	}
+
+	shared := &CachePolicy{TTL: time.Minute}
+	a := NewSubView("nav", "nav.html", Noop)
+	a.Cache = shared
+	b := NewSubView("nav", "nav.html", Delegate("items"))
+	b.Cache = shared
+	if fragmentKey(fragmentID(a), a, req) == fragmentKey(fragmentID(b), b, req) {
+		t.Error("Expecting views with a different handler to have a different key")
+	}
+
+	// the key is stable, it does not depend upon the policy instance
+	c := NewSubView("nav", "nav.html", Noop)
+	c.Cache = &CachePolicy{TTL: time.Minute}
+	if fragmentKey(fragmentID(a), a, req) != fragmentKey(fragmentID(c), c, req) {
+		t.Error("Expecting equivalent views to have the same key")
+	}
+}
+
+func TestFragmentIDs(t *testing.T) {
+	ft := setupFragmentTest()
+	th := ft.handler(t, ft.nav)
+	for _, nav := range []*View{th.Page.SubViews["nav"], th.Partial} {
+		if got, ok := th.fragmentIDs[nav]; !ok || got != fragmentID(nav) {
+			t.Errorf("Expecting the fragment ID of the nav to be computed with the handler, got %q", got)
+		}
+	}
+	for v := range th.fragmentIDs {
+		if v.Defines != "nav" {
+			t.Errorf("Expecting only cached views to have a fragment ID, got %s", SprintViewInfo(v))
+		}
+	}
+}
+
+func TestFragmentCache_SeparateEndpoints(t *testing.T) {
+	exec := NewKeyedStringExecutor(map[string]string{
+		"base.html": `<body>{{ template "nav" .Nav }}</body>`,
+		"nav.html":  `<nav>{{ . }}</nav>`,
+	})
+	newEndpoint := func(title string) http.Handler {
+		base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+			return map[string]interface{}{
+				"Nav": rsp.HandleSubView("nav", req),
+			}
+		})
+		nav := base.NewDefaultSubView("nav", "nav.html", Constant(title))
+		nav.Cache = &CachePolicy{Name: title, TTL: time.Minute}
+		return exec.NewViewHandler(nav)
+	}
+	admin := newEndpoint("ADMIN NAV")
+	public := newEndpoint("public")
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	serveFragmentTest(admin, "/admin", "text/html")
+	if got := sDumpBody(serveFragmentTest(public, "/", "text/html")); got != `<body><nav>public</nav></body>` {
+		t.Errorf("Expecting the public nav, got %s", got)
+	}
+	if got := sDumpBody(serveFragmentTest(admin, "/admin", TemplateContentType)); got != "<template>\n<nav>ADMIN NAV</nav>\n</template>" {
+		t.Errorf("Expecting the admin nav, got %s", got)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/rur/treetop
 
-go 1.13
+go 1.22
@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"sync"
@@ -46,6 +46,7 @@ type ViewHandler interface {
 	http.Handler
 	FragmentOnly() ViewHandler
 	PageOnly() ViewHandler
+	AllowMethods(...string) ViewHandler
 }
 
 // Errors used by the TemplateHandler.
@@ -71,6 +72,61 @@ type TemplateHandler struct {
 	IncludeTemplates []Template
 	// optional developer defined error handler
 	ServeTemplateError func(error, Response, *http.Request)
+	// Logger is used to report errors, the slog default logger is used when nil
+	Logger *slog.Logger
+	// Observer is notified as handlers and templates are executed, for instrumentation
+	Observer Observer
+	// ConcurrentSubViews enables the handlers of sibling sub views to be executed in parallel.
+	// A view handler starts sub view handlers in separate goroutines using PrefetchSubViews,
+	// HandleSubView will wait for the result. Sub views that are not prefetched are executed
+	// when they are requested, as usual.
+	//
+	// Note that sub view handlers will be executed with the request passed to the
+	// parent handler. Headers added by a sub view handler are merged into the response
+	// when the parent receives the data, those of sub views which are not requested are discarded.
+	ConcurrentSubViews bool
+	// StreamPage enables streaming of full page responses. Static HTML at the beginning of the
+	// page template is sent before any handler is executed so that the browser can begin loading
+	// page resources. The rest of the document is written to the connection as it is rendered.
+	//
+	// When ConcurrentSubViews is also enabled, the blocks of views with Stream enabled are
+	// streamed as they complete. The parent handler receives a placeholder for the view data
+	// without waiting, the document is sent up to the block of the view and the block is
+	// rendered once the handler of the view is done. Streamed views cannot change the status
+	// or headers of the response, unless views of the page have an error template, in which
+	// case the document is rendered after all handlers have completed.
+	//
+	// Note that once the page head has been sent, handlers cannot change the response status
+	// or headers, nor write to the response directly. View error templates are substituted
+	// for failed blocks as usual, but the status of the response will not change once the
+	// head has been sent. Any other error after output has been sent will abort the connection.
+	StreamPage bool
+	// ETags enables strong entity tags computed from the response body of page and template
+	// requests. A request with a matching If-None-Match header will receive a 304 Not Modified
+	// response without a body. Streamed pages are not tagged.
+	ETags bool
+	// Encoders are used to compress page and template responses, in order of preference.
+	// The encoding is negotiated using the Accept-Encoding request header,
+	// for example []Encoder{GzipEncoder{}}. Streamed pages are not compressed.
+	Encoders []Encoder
+	// CompressMinSize is the smallest response body in bytes that will be compressed,
+	// DefaultCompressMinSize is used when this is zero
+	CompressMinSize int
+	// AllowedMethods restricts the HTTP request methods handled, other requests will receive
+	// a 405 Method Not Allowed response with an Allow header. HEAD is allowed along with GET.
+	// All methods are handled when this is empty.
+	AllowedMethods []string
+
+	// static HTML at the start of the page template
+	pageHead []byte
+	// combined cache control declarations of the page and partial views
+	pageCacheControl    *CacheControl
+	partialCacheControl *CacheControl
+	// error boundaries for page, partial and include templates
+	pageErrors     *errorBoundaries
+	partialErrors  *errorBoundaries
+	includesErrors []*errorBoundaries
+	fragmentIDs    map[*View]string
 }
 
 // NewTemplateHandler compiles an endpoint view hierarchy and loads corresponding HTML templates
@@ -81,42 +137,44 @@ func NewTemplateHandler(view *View, includes []*View, load *TemplateLoader) (*Te
 		Partial:          part,
 		Includes:         incls,
 		IncludeTemplates: make([]Template, len(incls)),
+		includesErrors:   make([]*errorBoundaries, len(incls)),
 	}
 
+	handler.fragmentIDs = fragmentIDs(append([]*View{page, part}, incls...)...)
+	handler.pageCacheControl = viewCacheControl(page)
+	handler.partialCacheControl = viewCacheControl(append([]*View{part}, incls...)...)
+
 	var templateErrors ExecutorErrors
 
-	if t, err := load.ViewTemplate(page); err != nil {
-		templateErrors = append(templateErrors, &ExecutorError{
-			View: page,
-			Err:  err,
-		})
+	if t, eb, err := load.viewTemplate(page); err != nil {
+		templateErrors = append(templateErrors, newExecutorError(page, err))
 		// this handler will not accept page requests
 		handler.Page = nil
 	} else {
 		handler.PageTemplate = t
+		handler.pageErrors = eb
+		if page != nil {
+			handler.pageHead = staticPageHead(t, page.Defines)
+		}
 	}
 
-	if t, err := load.ViewTemplate(part); err != nil {
-		templateErrors = append(templateErrors, &ExecutorError{
-			View: part,
-			Err:  err,
-		})
+	if t, eb, err := load.viewTemplate(part); err != nil {
+		templateErrors = append(templateErrors, newExecutorError(part, err))
 		// error has been captured, disable partial handling
 		handler.Partial = nil
 	} else {
 		handler.PartialTemplate = t
+		handler.partialErrors = eb
 	}
 
 	for i, inc := range incls {
-		if t, err := load.ViewTemplate(inc); err != nil {
-			templateErrors = append(templateErrors, &ExecutorError{
-				View: inc,
-				Err:  err,
-			})
+		if t, eb, err := load.viewTemplate(inc); err != nil {
+			templateErrors = append(templateErrors, newExecutorError(inc, err))
 			// error has been captured, disable partial handing
 			handler.Partial = nil
 		} else {
 			handler.IncludeTemplates[i] = t
+			handler.includesErrors[i] = eb
 		}
 	}
 	return handler, templateErrors
@@ -125,27 +183,100 @@ func NewTemplateHandler(view *View, includes []*View, load *TemplateLoader) (*Te
 // FragmentOnly creates a new Handler that only responds to fragment requests
 func (h *TemplateHandler) FragmentOnly() ViewHandler {
 	return &TemplateHandler{
-		Partial:          h.Partial,
-		Includes:         h.Includes,
-		PartialTemplate:  h.PartialTemplate,
-		IncludeTemplates: h.IncludeTemplates,
+		Partial:             h.Partial,
+		Includes:            h.Includes,
+		PartialTemplate:     h.PartialTemplate,
+		IncludeTemplates:    h.IncludeTemplates,
+		ConcurrentSubViews:  h.ConcurrentSubViews,
+		Logger:              h.Logger,
+		Observer:            h.Observer,
+		ETags:               h.ETags,
+		Encoders:            h.Encoders,
+		CompressMinSize:     h.CompressMinSize,
+		AllowedMethods:      h.AllowedMethods,
+		partialCacheControl: h.partialCacheControl,
+		partialErrors:       h.partialErrors,
+		includesErrors:      h.includesErrors,
+		fragmentIDs:         h.fragmentIDs,
 	}
 }
 
 // PageOnly create a new handler that will only respond to non-fragment (full page) requests
 func (h *TemplateHandler) PageOnly() ViewHandler {
 	return &TemplateHandler{
-		Page:         h.Page,
-		PageTemplate: h.PageTemplate,
+		Page:               h.Page,
+		PageTemplate:       h.PageTemplate,
+		ConcurrentSubViews: h.ConcurrentSubViews,
+		StreamPage:         h.StreamPage,
+		Logger:             h.Logger,
+		Observer:           h.Observer,
+		ETags:              h.ETags,
+		Encoders:           h.Encoders,
+		CompressMinSize:    h.CompressMinSize,
+		AllowedMethods:     h.AllowedMethods,
+		pageHead:           h.pageHead,
+		pageCacheControl:   h.pageCacheControl,
+		pageErrors:         h.pageErrors,
+		fragmentIDs:        h.fragmentIDs,
 	}
 }
 
+// AllowMethods creates a new handler that will only respond to requests with one of the
+// supplied HTTP methods, see AllowedMethods
+func (h *TemplateHandler) AllowMethods(methods ...string) ViewHandler {
+	clone := *h
+	clone.AllowedMethods = methods
+	return &clone
+}
+
 // ServeHTTP is responsible for directing the handing of an incoming request.
 // Implements the procedure through which views functions and templates
 // are to be executed.
+//
+// Handlers and templates are executed for a HEAD request as they would be for GET,
+// so that the headers are the same, but the response body is not written.
 func (h *TemplateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var ow *observedWriter
+	if h.Observer != nil {
+		// record the outcome of the response for the observer, whatever the path taken
+		ow = &observedWriter{ResponseWriter: w}
+		w = ow
+	}
+	if req.Method == http.MethodHead {
+		w = &headResponseWriter{w}
+	}
 	resp := BeginResponse(req.Context(), w)
 	defer resp.Cancel()
+	resp.observer = h.Observer
+	resp.fragment = IsTemplateRequest(req)
+	completed := false
+	if ow != nil {
+		defer func() {
+			resp.observeWrite(req, h.endpointView(), ow, completed)
+		}()
+	}
+	h.serveResponse(resp, req)
+	completed = true
+}
+
+// serveResponse will handle a request using the treetop response
+func (h *TemplateHandler) serveResponse(resp *ResponseWrapper, req *http.Request) {
+	if !methodAllowed(h.AllowedMethods, req.Method) {
+		serveMethodNotAllowed(resp.ResponseWriter, h.AllowedMethods)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h.serveHandlerPanic(resp, req, r)
+		}
+	}()
+	if h.ConcurrentSubViews {
+		resp.shared = &concurrentState{}
+	}
+	resp.fragments = &renderedFragments{ids: h.fragmentIDs}
+	if h.hasErrorBoundaries(resp.fragment) {
+		resp.failures = &viewFailures{}
+	}
 
 	if IsTemplateRequest(req) {
 		if h.Page != nil {
@@ -155,15 +286,44 @@ func (h *TemplateHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 		// render treetop template, application/x.treetop-html-template+xml
 		h.serveTemplateRequest(resp, req)
+	} else if h.StreamPage {
+		// render a HTML document, writing to the connection as it is rendered
+		h.streamPageRequest(resp, req)
 	} else {
 		// render a HTML document, text/html
 		h.servePageRequest(resp, req)
 	}
 }
 
+// hasErrorBoundaries reports whether an error template is available for the views
+// rendered by a page or template request
+func (h *TemplateHandler) hasErrorBoundaries(fragment bool) bool {
+	if !fragment {
+		return h.pageErrors != nil
+	}
+	if h.partialErrors != nil {
+		return true
+	}
+	for _, eb := range h.includesErrors {
+		if eb != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointView is the view of the handler endpoint, the partial view unless
+// the handler only serves full page requests
+func (h *TemplateHandler) endpointView() *View {
+	if h.Partial != nil {
+		return h.Partial
+	}
+	return h.Page
+}
+
 // servePageRequest will render a HTML document using hierarchial handlers and templates
 func (h *TemplateHandler) servePageRequest(resp *ResponseWrapper, req *http.Request) {
-	errlog := h.newResponseErrorLog(resp, req)
+	errlog := h.newResponseErrorLog(resp, req, h.Page)
 
 	// response body will be buffered before being written to the connection
 	// to avoid torn writes as a result of errors
@@ -176,38 +336,56 @@ func (h *TemplateHandler) servePageRequest(resp *ResponseWrapper, req *http.Requ
 		errlog(ErrNotAcceptable)
 		return
 	}
-	data := h.Page.HandlerFunc(resp.WithSubViews(h.Page.SubViews), req)
+	data := resp.WithSubViews(h.Page.SubViews).execute(h.Page, req)
 	if resp.Finished() {
 		return
 	}
-	err := h.PageTemplate.ExecuteTemplate(buf, h.Page.Defines, data)
+	err := h.executeTemplate(resp, req, buf, h.PageTemplate, h.pageErrors, h.Page, data)
 	if err != nil {
 		errlog(err)
 		return
 	}
 
-	// set content length from write buffer
-	resp.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	h.setPageHeaders(resp.Header())
 
-	if h.Partial != nil {
-		// inform cache that another content type is possible for this endpoint
-		resp.Header().Add("Vary", "Accept")
+	// choose an encoding if the client accepts one that is configured, the body is
+	// compressed only once it is known that it will be sent
+	enc, encoding := h.responseEncoder(resp.Header(), req, buf.Bytes()), ""
+	if enc != nil {
+		encoding = enc.Encoding()
 	}
 
-	// set content type as standard html mimetype
-	resp.Header().Set("Content-Type", "text/html")
+	status := resp.Status(0)
+	setCacheControl(resp.Header(), h.pageCacheControl, status)
+	if h.ETags && checkNotModified(resp.Header(), req, status, newETag("text/html", buf.Bytes(), encoding)) {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	if status := resp.Status(0); status > 0 {
+	body := buf
+	if enc != nil {
+		encoded, err := encodeResponseBody(resp.Header(), enc, buf.Bytes())
+		if err != nil {
+			errlog(err)
+			return
+		}
+		defer releaseBuffer(encoded)
+		body = encoded
+	}
+
+	// set content length from write buffer
+	resp.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if status > 0 {
 		// response instance was given a status code,
 		// write the status, finalizing the headers
 		resp.WriteHeader(status)
 	}
 
 	// copy from buffer to the connection writer
-	if _, err := io.Copy(resp, buf); err != nil {
+	if _, err := io.Copy(resp, body); err != nil {
 		// It is likely that the header has been written at this stage,
 		// hence there is no ability to notify the client of this error.
-		log.Printf("treetop: page write error %s", err)
+		h.logResponse(slog.LevelError, "treetop: page write error", resp, req, h.Page, err)
 
 		// This will be ignored if the header was sent
 		http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -217,7 +395,7 @@ func (h *TemplateHandler) servePageRequest(resp *ResponseWrapper, req *http.Requ
 // serverTemplateRequest will execute the partial along with each postscript handler in order
 // then append the postscript HTML to partial HTML
 func (h *TemplateHandler) serveTemplateRequest(resp *ResponseWrapper, req *http.Request) {
-	errlog := h.newResponseErrorLog(resp, req)
+	errlog := h.newResponseErrorLog(resp, req, h.Partial)
 
 	// This is a template request,
 	if h.Partial == nil {
@@ -234,6 +412,7 @@ func (h *TemplateHandler) serveTemplateRequest(resp *ResponseWrapper, req *http.
 		views = append([]*View{h.Partial}, h.Includes...)
 		data  = make([]interface{}, len(views))
 		tmpls = append([]Template{h.PartialTemplate}, h.IncludeTemplates...)
+		ebs   = append([]*errorBoundaries{h.partialErrors}, h.includesErrors...)
 	)
 
 	// call handler for partial and each postscript view. Collect template data.
@@ -241,7 +420,7 @@ func (h *TemplateHandler) serveTemplateRequest(resp *ResponseWrapper, req *http.
 		if view == nil {
 			continue
 		}
-		data[i] = view.HandlerFunc(resp.WithSubViews(view.SubViews), req)
+		data[i] = resp.WithSubViews(view.SubViews).execute(view, req)
 		if resp.Finished() {
 			return
 		}
@@ -254,9 +433,13 @@ func (h *TemplateHandler) serveTemplateRequest(resp *ResponseWrapper, req *http.
 		if i > 0 {
 			buf.WriteByte('\n')
 		}
-		err := tmpl.ExecuteTemplate(buf, views[i].Defines, data[i])
+		var eb *errorBoundaries
+		if i < len(ebs) {
+			eb = ebs[i]
+		}
+		err := h.executeTemplate(resp, req, buf, tmpl, eb, views[i], data[i])
 		if err != nil {
-			errlog(err)
+			h.newResponseErrorLog(resp, req, views[i])(err)
 			return
 		}
 	}
@@ -270,22 +453,55 @@ func (h *TemplateHandler) serveTemplateRequest(resp *ResponseWrapper, req *http.
 		return
 	}
 
+	// choose an encoding if the client accepts one that is configured, the body is
+	// compressed only once it is known that it will be sent
+	enc, encoding := h.responseEncoder(resp.Header(), req, buf.Bytes()), ""
+	if enc != nil {
+		encoding = enc.Encoding()
+	}
+
+	setCacheControl(resp.Header(), h.partialCacheControl, resp.Status(0))
+
+	if h.ETags {
+		history := ""
+		if resp.replaceURL {
+			history = "replace"
+		}
+		etag := newETag(TemplateContentType, buf.Bytes(), resp.pageURL, history, encoding)
+		if checkNotModified(resp.Header(), req, resp.Status(0), etag) {
+			ttW.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	body := buf
+	if enc != nil {
+		encoded, err := encodeResponseBody(resp.Header(), enc, buf.Bytes())
+		if err != nil {
+			h.newResponseErrorLog(resp, req, h.Partial)(err)
+			return
+		}
+		defer releaseBuffer(encoded)
+		body = encoded
+	}
+
 	// set content length from write buffer
-	resp.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	resp.Header().Set("Content-Length", strconv.Itoa(body.Len()))
 
 	// copy from buffer to the connection
-	if _, err := io.Copy(ttW, buf); err != nil {
+	if _, err := io.Copy(ttW, body); err != nil {
 		// It is likely that the header has been written at this stage,
 		// hence there is no ability to notify the client of this error.
-		log.Printf("treetop: partial write error %s", err)
+		h.logResponse(slog.LevelError, "treetop: partial write error", resp, req, h.Partial, err)
 
 		// This will be ignored if the header was sent
 		http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
 
-// newResponseErrorLog create an error handler for a supplied response and request instance
-func (h *TemplateHandler) newResponseErrorLog(rsp Response, req *http.Request) func(err error) {
+// newResponseErrorLog create an error handler for a supplied response and request instance,
+// the view is the page or partial being rendered
+func (h *TemplateHandler) newResponseErrorLog(rsp Response, req *http.Request, view *View) func(err error) {
 	return func(err error) {
 		if h.ServeTemplateError != nil {
 			if err == ErrNotAcceptable {
@@ -297,11 +513,11 @@ func (h *TemplateHandler) newResponseErrorLog(rsp Response, req *http.Request) f
 		}
 
 		if err == ErrNotAcceptable {
+			h.logResponse(slog.LevelInfo, "treetop: not acceptable", rsp, req, view, nil)
 			http.Error(rsp, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
 			return
 		}
-		// use log pkg standard logger
-		log.Printf("treetop template handler error, %s", err)
+		h.logResponse(slog.LevelError, "treetop: template handler error", rsp, req, view, err)
 		http.Error(rsp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var handlerTemplateTestTemplateMap = map[string]string{
@@ -229,3 +231,332 @@ func TestTemplateHandler_AdditionalVaryHeaders(t *testing.T) {
 		t.Errorf("Expecting Vary header to be [%s], got %v", expecting, varyHeader)
 	}
 }
+
+func TestTemplateHandler_ConcurrentSubViews(t *testing.T) {
+	th, ok := setupTemplateHandler().(*TemplateHandler)
+	if !ok {
+		t.Fatal("Expecting a *TemplateHandler")
+	}
+	th.ConcurrentSubViews = true
+
+	for _, accept := range []string{"*/*", TemplateContentType} {
+		sequential := httptest.NewRecorder()
+		concurrent := httptest.NewRecorder()
+		setupTemplateHandler().ServeHTTP(sequential, mockRequest("/some/path", accept))
+		th.ServeHTTP(concurrent, mockRequest("/some/path", accept))
+
+		if concurrent.Code != sequential.Code {
+			t.Errorf("Accept %s: expecting status %d, got %d", accept, sequential.Code, concurrent.Code)
+		}
+		gotVary := strings.Join(concurrent.Header().Values("Vary"), ", ")
+		expectVary := strings.Join(sequential.Header().Values("Vary"), ", ")
+		if gotVary != expectVary {
+			t.Errorf("Accept %s: expecting Vary header: [%s], got: [%s]", accept, expectVary, gotVary)
+		}
+		if got, want := concurrent.Body.String(), sequential.Body.String(); got != want {
+			t.Errorf("Accept %s: expecting body \n%s\nGOT\n%s", accept, want, got)
+		}
+	}
+}
+
+func TestTemplateHandler_StreamPage(t *testing.T) {
+	th, ok := setupTemplateHandler().(*TemplateHandler)
+	if !ok {
+		t.Fatal("Expecting a *TemplateHandler")
+	}
+	th.StreamPage = true
+
+	buffered := httptest.NewRecorder()
+	streamed := httptest.NewRecorder()
+	setupTemplateHandler().ServeHTTP(buffered, mockRequest("/some/path", "*/*"))
+	th.ServeHTTP(streamed, mockRequest("/some/path", "*/*"))
+
+	if streamed.Code != buffered.Code {
+		t.Errorf("Expecting status %d, got %d", buffered.Code, streamed.Code)
+	}
+	if got := streamed.Header().Get("Content-Type"); got != "text/html" {
+		t.Errorf("Expecting content type text/html, got %s", got)
+	}
+	if got := streamed.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Expecting no content length for a streamed response, got %s", got)
+	}
+	if !streamed.Flushed {
+		t.Error("Expecting streamed response to have been flushed")
+	}
+	if got, want := streamed.Body.String(), buffered.Body.String(); got != want {
+		t.Errorf("Expecting body \n%s\nGOT\n%s", want, got)
+	}
+}
+
+func TestTemplateHandler_StreamPageHeadBeforeHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var headAtHandler string
+	base := NewView(`<!DOCTYPE html><html><head><link rel="stylesheet" href="/a.css"><title>{{ .Title }}</title></head>`+
+		`<body>{{ template "content" .Content }}</body></html>`,
+		func(rsp Response, req *http.Request) interface{} {
+			headAtHandler = rec.Body.String()
+			rsp.Status(http.StatusCreated)
+			return map[string]interface{}{
+				"Title":   "Streamed",
+				"Content": rsp.HandleSubView("content", req),
+			}
+		})
+	base.NewDefaultSubView("content", `<p>{{ . }}</p>`, Constant("Hello"))
+
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	th.StreamPage = true
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	if want := `<!DOCTYPE html><html><head><link rel="stylesheet" href="/a.css">`; headAtHandler != want {
+		t.Errorf("Expecting page head to be written before handler, expecting %s got %s", want, headAtHandler)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expecting status to be committed before handler, got %d", rec.Code)
+	}
+	want := `<!DOCTYPE html><html><head><link rel="stylesheet" href="/a.css"><title>Streamed</title></head>` +
+		`<body><p>Hello</p></body></html>`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Expecting body \n%s\nGOT\n%s", want, got)
+	}
+}
+
+func TestTemplateHandler_StreamPageHijackBeforeHead(t *testing.T) {
+	// no static page head, the response is not committed before handlers are executed
+	base := NewView(`{{ template "content" . }}`, Delegate("content"))
+	base.NewDefaultSubView("content", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		http.Redirect(rsp, req, "/other", http.StatusSeeOther)
+		return nil
+	})
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.StreamPage = true
+
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("Expecting redirect status, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Location"); got != "/other" {
+		t.Errorf("Expecting redirect location, got %s", got)
+	}
+}
+
+func TestTemplateHandler_StreamPageErrorAfterHead(t *testing.T) {
+	base := NewView(`<html><body>{{ template "content" . }}</body></html>`, Delegate("content"))
+	base.NewDefaultSubView("content", `<p>{{ .FAIL }}</p>`, Constant("data"))
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.StreamPage = true
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("Expecting connection to be aborted, got %v", r)
+		}
+		if got := rec.Body.String(); got != "<html><body>" {
+			t.Errorf("Expecting only the page head to be written, got %s", got)
+		}
+	}()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	t.Error("Expecting handler to panic")
+}
+
+func TestTemplateHandler_StreamPageErrorBeforeOutput(t *testing.T) {
+	base := NewView(`{{ template "content" . }}`, Delegate("content"))
+	base.NewDefaultSubView("content", `<p>{{ .FAIL }}</p>`, Constant("data"))
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.StreamPage = true
+
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+// flushRecorder records the body sent to the client each time the response is flushed
+type flushRecorder struct {
+	mu      sync.Mutex
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	flushed chan string
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{
+		header:  make(http.Header),
+		flushed: make(chan string, 100),
+	}
+}
+
+func (fr *flushRecorder) Header() http.Header {
+	return fr.header
+}
+
+func (fr *flushRecorder) WriteHeader(status int) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.status == 0 {
+		fr.status = status
+	}
+}
+
+func (fr *flushRecorder) Write(p []byte) (int, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.status == 0 {
+		fr.status = http.StatusOK
+	}
+	return fr.body.Write(p)
+}
+
+func (fr *flushRecorder) Flush() {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.flushed <- fr.body.String()
+}
+
+func setupStreamedBlocks(slow ViewHandlerFunc) *TemplateHandler {
+	base := NewView(`<html><body><header>{{ .Title }}</header>{{ template "slow" .Slow }}<footer>{{ template "fast" .Fast }}</footer></body></html>`,
+		func(rsp Response, req *http.Request) interface{} {
+			return map[string]interface{}{
+				"Title": "Page",
+				"Slow":  rsp.HandleSubView("slow", req),
+				"Fast":  rsp.HandleSubView("fast", req),
+			}
+		})
+	base.NewDefaultSubView("slow", `<main>{{ . }}</main>`, slow).Stream = true
+	base.NewDefaultSubView("fast", `<p>{{ . }}</p>`, Constant("Fast"))
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.StreamPage = true
+	th.ConcurrentSubViews = true
+	return th
+}
+
+func TestTemplateHandler_StreamPageBlocks(t *testing.T) {
+	release := make(chan struct{})
+	th := setupStreamedBlocks(func(rsp Response, req *http.Request) interface{} {
+		<-release
+		rsp.Status(http.StatusNotFound)
+		return "Slow"
+	})
+
+	w := newFlushRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		th.ServeHTTP(w, mockRequest("/some/path", "text/html"))
+	}()
+
+	// content preceding the streamed block is sent while the handler is blocked
+	want := `<html><body><header>Page</header>`
+	timeout := time.After(5 * time.Second)
+	for sent := ""; sent != want; {
+		select {
+		case sent = <-w.flushed:
+		case <-timeout:
+			t.Fatalf("Expecting %s to be sent before the streamed view completed", want)
+		}
+	}
+	close(release)
+	<-done
+
+	if w.status != http.StatusOK {
+		t.Errorf("Expecting status to be sent before the streamed view completed, got %d", w.status)
+	}
+	want = `<html><body><header>Page</header><main>Slow</main><footer><p>Fast</p></footer></body></html>`
+	if got := w.body.String(); got != want {
+		t.Errorf("Expecting body \n%s\nGOT\n%s", want, got)
+	}
+}
+
+func TestTemplateHandler_StreamPageBlocksNotStreamed(t *testing.T) {
+	th := setupStreamedBlocks(Constant("Slow"))
+	th.ConcurrentSubViews = false
+
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expecting status %d, got %d", http.StatusOK, rec.Code)
+	}
+	want := `<html><body><header>Page</header><main>Slow</main><footer><p>Fast</p></footer></body></html>`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Expecting body \n%s\nGOT\n%s", want, got)
+	}
+}
+
+func TestTemplateHandler_StreamPageBlockPanic(t *testing.T) {
+	th := setupStreamedBlocks(func(rsp Response, req *http.Request) interface{} {
+		panic("something went wrong")
+	})
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("Expecting connection to be aborted, got %v", r)
+		}
+		if got := rec.Body.String(); got != "<html><body><header>Page</header>" {
+			t.Errorf("Expecting the document preceding the block to be written, got %s", got)
+		}
+	}()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	t.Error("Expecting handler to panic")
+}
+
+func TestTemplateHandler_StreamPageBlockErrorTemplate(t *testing.T) {
+	base := NewView(`{{ template "slow" .Slow }}<footer>{{ template "fast" .Fast }}</footer>`,
+		func(rsp Response, req *http.Request) interface{} {
+			return map[string]interface{}{
+				"Slow": rsp.HandleSubView("slow", req),
+				"Fast": rsp.HandleSubView("fast", req),
+			}
+		})
+	slow := base.NewDefaultSubView("slow", `<main>{{ . }}</main>`, func(rsp Response, req *http.Request) interface{} {
+		panic("something went wrong")
+	})
+	slow.Stream = true
+	slow.ErrorTemplate = `<main>Unavailable</main>`
+	base.NewDefaultSubView("fast", `<p>{{ . }}</p>`, Constant("Fast"))
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	th.StreamPage = true
+	th.ConcurrentSubViews = true
+
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	want := `<main>Unavailable</main><footer><p>Fast</p></footer>`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Expecting body \n%s\nGOT\n%s", want, got)
+	}
+}
+
+func TestTemplateHandler_StreamTypedView(t *testing.T) {
+	base := NewView(`{{ template "content" .Content }}`, Delegate("content"))
+	content := NewDefaultTypedSubView(base, "content", `<p>{{ .Name }}</p>`, func(rsp Response, req *http.Request) streamTypedData {
+		return streamTypedData{Name: "typed"}
+	})
+	content.Stream = true
+	exec := StringExecutor{}
+	exec.NewViewHandler(base)
+	errs := exec.FlushErrors()
+	if len(errs) == 0 || !strings.Contains(errs[0].Error(), "cannot be streamed") {
+		t.Errorf("Expecting an error for a streamed view with a data type, got %v", errs)
+	}
+}
+
+type streamTypedData struct {
+	Name string
+}
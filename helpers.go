@@ -2,7 +2,6 @@ package treetop
 
 import (
 	"net/http"
-	"strings"
 )
 
 // Noop treetop handler helper is useful when a treetop.HandlerFunc instance is needed
@@ -36,13 +35,12 @@ func RequestHandler(f func(*http.Request) interface{}) ViewHandlerFunc {
 
 // IsTemplateRequest is a predicate function which will check the headers of a given request
 // and return true if a template response is supported by the client.
+//
+// The Accept header is parsed as a list of media ranges with quality values (RFC 7231).
+// The template content type must be named explicitly, wildcard ranges are not sufficient.
+// If the client also accepts text/html, the template is used unless HTML has a greater weight.
 func IsTemplateRequest(req *http.Request) bool {
-	for _, accept := range strings.Split(req.Header.Get("Accept"), ";") {
-		if strings.ToLower(strings.TrimSpace(accept)) == TemplateContentType {
-			return true
-		}
-	}
-	return false
+	return acceptsMediaType(req, TemplateContentType)
 }
 
 // Redirect is a helper that will instruct the Treetop client library to direct the web browser
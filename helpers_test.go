@@ -27,6 +27,36 @@ func TestIsTemplateRequest(t *testing.T) {
 			req:  mockRequest("/Some/path", "text/html; "+TemplateContentType),
 			want: true,
 		},
+		{
+			name: "comma separated list",
+			req:  mockRequest("/Some/path", "text/html, "+TemplateContentType),
+			want: true,
+		},
+		{
+			name: "template with quality value",
+			req:  mockRequest("/Some/path", TemplateContentType+";q=0.9"),
+			want: true,
+		},
+		{
+			name: "html is preferred",
+			req:  mockRequest("/Some/path", "text/html, "+TemplateContentType+";q=0.9"),
+			want: false,
+		},
+		{
+			name: "template is not acceptable",
+			req:  mockRequest("/Some/path", TemplateContentType+";q=0, */*"),
+			want: false,
+		},
+		{
+			name: "browser navigation",
+			req:  mockRequest("/Some/path", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"),
+			want: false,
+		},
+		{
+			name: "case insensitive",
+			req:  mockRequest("/Some/path", "Application/X.Treetop-HTML-Template+XML"),
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,197 @@
+package treetop
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+)
+
+// Inspector wraps another executor, recording each view handler that is created so that
+// a map of the site can be served for developers. The inspector page lists every endpoint
+// with the compiled page view, partial view and postscript includes, the templates
+// involved and any template errors.
+//
+// When a Router is supplied the route patterns for each endpoint are included.
+//
+// Example:
+//
+//	exec := &treetop.Inspector{ViewExecutor: &treetop.FileExecutor{}}
+//	mux.Handle("/items", exec.NewViewHandler(itemList))
+//	mux.Handle("/debug/views", exec)
+//
+// Note: the inspector exposes the internals of a site, it should not be served publicly
+type Inspector struct {
+	ViewExecutor
+	// Router is used to find the route patterns of each endpoint, optional
+	Router *Router
+
+	mu        sync.Mutex
+	captured  CaptureErrors
+	endpoints []*inspectedEndpoint
+}
+
+// inspectedEndpoint is a view handler created by the inspector executor
+type inspectedEndpoint struct {
+	view     *View
+	includes []*View
+	errs     ExecutorErrors
+}
+
+// NewViewHandler creates a view handler using the wrapped executor, the endpoint
+// and any template errors are recorded
+func (in *Inspector) NewViewHandler(view *View, includes ...*View) ViewHandler {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	handler := in.ViewExecutor.NewViewHandler(view, includes...)
+	errs := in.ViewExecutor.FlushErrors()
+	in.captured.AddErrors(errs)
+	in.endpoints = append(in.endpoints, &inspectedEndpoint{
+		view:     view,
+		includes: append([]*View(nil), includes...),
+		errs:     errs,
+	})
+	return handler
+}
+
+// FlushErrors will return the list of template creation errors that occurred
+// while ViewHandlers were being created, since the last time it was called.
+func (in *Inspector) FlushErrors() ExecutorErrors {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.captured.FlushErrors()
+}
+
+// inspectorEndpointData is the template data for an endpoint of the inspector page
+type inspectorEndpointData struct {
+	Index        int
+	View         string
+	Routes       []string
+	PageView     string
+	TemplateView string
+	Includes     []string
+	Templates    []string
+	Errors       string
+}
+
+// ServeHTTP serves the inspector page listing all endpoints created by the executor
+func (in *Inspector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	in.mu.Lock()
+	endpoints := append([]*inspectedEndpoint(nil), in.endpoints...)
+	in.mu.Unlock()
+
+	var routes []*Route
+	if in.Router != nil {
+		routes = in.Router.Routes()
+	}
+	data := struct {
+		Endpoints  []inspectorEndpointData
+		ErrorCount int
+	}{}
+	for i, ep := range endpoints {
+		page, part, includes := CompileViews(ep.view, ep.includes...)
+		epData := inspectorEndpointData{
+			Index:     i,
+			View:      SprintViewInfo(ep.view),
+			Templates: listTemplatePaths(ep.view, ep.includes...),
+		}
+		if page != nil {
+			epData.PageView = SprintViewTree(page)
+		}
+		if part != nil {
+			epData.TemplateView = SprintViewTree(part)
+		}
+		for _, incl := range includes {
+			epData.Includes = append(epData.Includes, SprintViewTree(incl))
+		}
+		for _, route := range routes {
+			if route.View == ep.view {
+				epData.Routes = append(epData.Routes, route.Pattern)
+			}
+		}
+		if len(ep.errs) > 0 {
+			epData.Errors = ep.errs.Error()
+			data.ErrorCount += len(ep.errs)
+		}
+		data.Endpoints = append(data.Endpoints, epData)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := inspectorTemplate.Execute(w, data); err != nil {
+		panic(err)
+	}
+}
+
+// inspectorTemplate is used to draw the page served by an Inspector
+var inspectorTemplate = template.Must(template.New("inspector").Parse(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="utf-8">
+		<meta http-equiv="X-UA-Compatible" content="IE=edge">
+		<title>Treetop View Inspector</title>
+		<style type="text/css" media="screen">
+
+			body {
+				line-height: 140%;
+				margin: 50px;
+			}
+			code {font-size: 120%;}
+
+			pre code {
+				background-color: #eee;
+				border: 1px solid #999;
+				display: block;
+				padding: 20px;
+			}
+
+			.error code {
+				background-color: #fee;
+				border-color: #c33;
+			}
+
+		</style>
+	</head>
+	<body>
+		<h1>Treetop View Inspector</h1>
+		<p>{{ len .Endpoints }} endpoints, {{ .ErrorCount }} template errors</p>
+		<ul>
+		{{ range .Endpoints }}
+			<li><a href="#endpoint-{{ .Index }}">{{ range .Routes }}<code>{{ . }}</code> {{ end }}{{ .View }}</a>{{ if .Errors }} (errors){{ end }}</li>
+		{{ end }}
+		</ul>
+
+		{{ range .Endpoints }}
+		<section id="endpoint-{{ .Index }}">
+			<h2>{{ range .Routes }}<code>{{ . }}</code> {{ else }}Endpoint {{ .Index }}{{ end }}</h2>
+			<p><code>{{ .View }}</code></p>
+
+			{{ if .Errors }}
+			<h3>Errors:</h3>
+			<pre class="error"><code>{{ .Errors }}</code></pre>
+			{{ end }}
+
+			{{ if .PageView }}
+			<h3>Page View:</h3>
+			<pre><code>{{ .PageView }}</code></pre>
+			{{ end }}
+
+			{{ if .TemplateView }}
+			<h3>Template View:</h3>
+			<pre><code>{{ .TemplateView }}</code></pre>
+			{{ end }}
+
+			{{ range $index, $ps := .Includes }}
+			<h3>Postscript[{{ $index }}]:</h3>
+			<pre><code>{{ $ps }}</code></pre>
+			{{ end }}
+
+			<h3>Templates:</h3>
+			<ul>
+			{{ range .Templates }}
+				<li><code>{{ . }}</code></li>
+			{{ end }}
+			</ul>
+		</section>
+		{{ end }}
+	</body>
+	</html>
+`))
@@ -0,0 +1,55 @@
+package treetop
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInspector_ServeHTTP(t *testing.T) {
+	exec := &Inspector{ViewExecutor: NewKeyedStringExecutor(map[string]string{
+		"base.html":   `<main>{{ template "content" .Content }}</main>`,
+		"list.html":   `<ul>{{ range . }}<li>{{ . }}</li>{{ end }}</ul>`,
+		"notice.html": `<p>{{ . }}</p>`,
+		"broken.html": `<p>{{ .Broken </p>`,
+	})}
+	router := NewRouter(exec)
+	exec.Router = router
+
+	base := NewView("base.html", Noop)
+	list := base.NewSubView("content", "list.html", Constant([]string{"a"}))
+	notice := NewSubView("notice", "notice.html", Noop)
+	router.HandleView("GET /items", list, notice)
+	router.HandleView("GET /broken", base.NewSubView("content", "broken.html", Noop))
+	exec.NewViewHandler(NewView("notice.html", Noop))
+	exec.NewViewHandler(NewView("broken.html", Noop))
+	if errs := exec.FlushErrors(); len(errs) != 2 {
+		t.Errorf("Expecting page and partial errors for the broken template, got %v", errs)
+	}
+
+	if err := router.Err(); err == nil {
+		t.Error("Expecting router errors for the broken template")
+	}
+
+	rec := httptest.NewRecorder()
+	exec.ServeHTTP(rec, mockRequest("/debug/views", "text/html"))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Expecting HTML content type, got %q", ct)
+	}
+	body := sDumpBody(rec)
+	for _, expect := range []string{
+		"4 endpoints, 4 template errors",
+		`<code>GET /items</code>`,
+		`<code>GET /broken</code>`,
+		`<h2>Endpoint 2</h2>`,
+		`<h3>Postscript[0]:</h3>`,
+		`- SubView(&#34;notice&#34;, &#34;notice.html&#34;, github.com/rur/treetop.Noop)`,
+		`<li><code>list.html</code></li>`,
+		`<li><code>base.html</code></li>`,
+		`failed to parse template &#34;broken.html&#34;`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("Expecting inspector page to contain %q, got\n%s", expect, body)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package treetop
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventStreamContentType is used by the DeveloperExecutor to announce template changes
+	EventStreamContentType = "text/event-stream"
+
+	// liveReloadHeader is added to fragment requests made by the live reload hook
+	liveReloadHeader = "X-Treetop-Live-Reload"
+)
+
+// liveReloadInterval is the time between checks for template changes
+var liveReloadInterval = time.Second
+
+// liveReloadHook is injected into full page responses from a DeveloperExecutor endpoint.
+// The page subscribes to template change events of the endpoint and uses the treetop
+// client to merge the updated HTML into the current document, this preserves the scroll
+// position and form state outside the replaced elements. If the treetop client is not
+// available the page is reloaded.
+var liveReloadHook = []byte(`<script>
+(function () {
+	if (!window.EventSource) {
+		return;
+	}
+	var source = new EventSource(window.location.href);
+	source.addEventListener("change", function () {
+		if (window.treetop && typeof window.treetop.request === "function") {
+			window.treetop.request("GET", window.location.href, null, null, [["` + liveReloadHeader + `", "1"]]);
+		} else {
+			window.location.reload();
+		}
+	});
+})();
+</script>
+`)
+
+// acceptsEventStream returns true for requests from a browser EventSource
+func acceptsEventStream(req *http.Request) bool {
+	return acceptsMediaType(req, EventStreamContentType)
+}
+
+// serveTemplateChanges will stream an event each time one of the templates referenced by the
+// endpoint is modified, until the client disconnects.
+//
+// Event stream format:
+//
+//	event: change
+//	data: path/to/template.html
+func (h *devHandler) serveTemplateChanges(w http.ResponseWriter, req *http.Request) {
+	source, ok := h.exec.(TemplateSource)
+	flusher, canFlush := w.(http.Flusher)
+	if !ok || !canFlush {
+		// 204 will instruct the EventSource not to reconnect
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": watching templates\n\n")
+	flusher.Flush()
+
+	paths := listTemplatePaths(h.view, h.incl...)
+	hashes := hashTemplateSources(source, paths)
+	ticker := time.NewTicker(liveReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		current := hashTemplateSources(source, paths)
+		var changed []string
+		for path, hash := range current {
+			if hashes[path] != hash {
+				changed = append(changed, path)
+			}
+		}
+		hashes = current
+		if len(changed) == 0 {
+			continue
+		}
+		sort.Strings(changed)
+		for _, path := range changed {
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", path)
+		}
+		flusher.Flush()
+	}
+}
+
+// closeBodyTag is the tag that the live reload hook is inserted before
+var closeBodyTag = []byte("</body>")
+
+// liveReloadWriter adds the live reload script to a HTML document as it is written, the
+// script is inserted before the closing body tag, matched without regard to case.
+//
+// A response with a Content-Length header is held until the body is complete so that the
+// length can be corrected. Otherwise the document is written through, retaining at most a
+// partial closing tag between writes, so that streamed responses can be flushed.
+type liveReloadWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	inject      bool
+	injected    bool
+	buffered    bool
+	// body held for a response with a Content-Length, or a partial closing tag
+	pending []byte
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *liveReloadWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	header := w.Header()
+	w.inject = strings.HasPrefix(header.Get("Content-Type"), "text/html") &&
+		header.Get("Content-Encoding") == "" &&
+		status != http.StatusNotModified
+	w.buffered = w.inject && header.Get("Content-Length") != ""
+	if !w.buffered {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write implements http.ResponseWriter
+func (w *liveReloadWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.inject || w.injected {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.buffered {
+		w.pending = append(w.pending, p...)
+		return len(p), nil
+	}
+	data := append(w.pending, p...)
+	w.pending = nil
+	if i := indexCloseBody(data); i > -1 {
+		w.injected = true
+		if _, err := w.ResponseWriter.Write(insertLiveReloadHook(data, i)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	// hold back the end of the data if it could be the start of a closing tag
+	keep := partialCloseBody(data)
+	if _, err := w.ResponseWriter.Write(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+	w.pending = append([]byte(nil), data[len(data)-keep:]...)
+	return len(p), nil
+}
+
+// Flush implements http.Flusher, a partial closing tag is retained
+func (w *liveReloadWriter) Flush() {
+	if w.buffered {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer, for use with http.ResponseController
+func (w *liveReloadWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes any body that has been held, it must be called when the handler returns
+func (w *liveReloadWriter) finish() {
+	body := w.pending
+	w.pending = nil
+	if !w.buffered {
+		if len(body) > 0 {
+			w.ResponseWriter.Write(body)
+		}
+		return
+	}
+	if i := indexCloseBody(body); i > -1 {
+		body = insertLiveReloadHook(body, i)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// insertLiveReloadHook creates a copy of the body with the hook inserted at an index
+func insertLiveReloadHook(body []byte, i int) []byte {
+	injected := make([]byte, 0, len(body)+len(liveReloadHook))
+	injected = append(injected, body[:i]...)
+	injected = append(injected, liveReloadHook...)
+	return append(injected, body[i:]...)
+}
+
+// indexCloseBody finds the last closing body tag in the data, ignoring case
+func indexCloseBody(data []byte) int {
+	return bytes.LastIndex(bytes.ToLower(data), closeBodyTag)
+}
+
+// partialCloseBody returns the length of the longest suffix of the data which is the
+// beginning of a closing body tag, ignoring case
+func partialCloseBody(data []byte) int {
+	for n := len(closeBodyTag) - 1; n > 0; n-- {
+		if n <= len(data) && bytes.EqualFold(data[len(data)-n:], closeBodyTag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// replaceHistoryWriter will instruct the treetop client to replace the current
+// history entry rather than adding a new one, this is used for live reload requests
+type replaceHistoryWriter struct {
+	http.ResponseWriter
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *replaceHistoryWriter) WriteHeader(status int) {
+	if w.Header().Get("X-Page-URL") != "" {
+		w.Header().Set("X-Response-History", "replace")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,152 @@
+package treetop
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeveloperExecutor_LiveReloadHook(t *testing.T) {
+	keyed := NewKeyedStringExecutor(map[string]string{
+		"base.html": `<html><body>{{ template "content" . }}</body></html>`,
+		"test.html": `<p id="content">Test {{ . }}</p>`,
+	})
+	dev := DeveloperExecutor{keyed}
+	base := NewView("base.html", Delegate("content"))
+	handler := dev.NewViewHandler(base.NewSubView("content", "test.html", Constant("data")))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	got := sDumpBody(rec)
+	expect := `<html><body><p id="content">Test data</p>` + string(liveReloadHook) + `</body></html>`
+	if got != expect {
+		t.Errorf("Expecting page with live reload hook\n%s\ngot\n%s", expect, got)
+	}
+	if length := rec.Header().Get("Content-Length"); length != strconv.Itoa(len(expect)) {
+		t.Errorf("Expecting Content-Length %d, got %s", len(expect), length)
+	}
+
+	// fragment requests from the live reload hook should replace the history entry
+	rec = httptest.NewRecorder()
+	req := mockRequest("/some/path", TemplateContentType)
+	req.Header.Set(liveReloadHeader, "1")
+	handler.ServeHTTP(rec, req)
+	if got := sDumpBody(rec); strings.Contains(got, "<script>") {
+		t.Errorf("Expecting live reload hook not to be added to template response, got %s", got)
+	}
+	if val := rec.Header().Get("X-Response-History"); val != "replace" {
+		t.Errorf("Expecting X-Response-History header of 'replace', got %#v", val)
+	}
+}
+
+func TestDeveloperExecutor_LiveReloadEvents(t *testing.T) {
+	defer func(interval time.Duration) {
+		liveReloadInterval = interval
+	}(liveReloadInterval)
+	liveReloadInterval = time.Millisecond
+
+	exec := &lockedKeyedExecutor{
+		KeyedStringExecutor: NewKeyedStringExecutor(map[string]string{
+			"test.html": `<p>Before {{ . }}</p>`,
+		}),
+	}
+	dev := DeveloperExecutor{exec}
+	server := httptest.NewServer(dev.NewViewHandler(NewView("test.html", Constant("data"))))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", EventStreamContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != EventStreamContentType {
+		t.Fatalf("Expecting event stream content type, got %s", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	if line := <-lines; !strings.HasPrefix(line, ":") {
+		t.Fatalf("Expecting initial comment, got %s", line)
+	}
+
+	exec.set("test.html", `<p>After {{ . }}</p>`)
+
+	var got []string
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			if line != "" {
+				got = append(got, line)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for change event, got %v", got)
+		}
+	}
+	if strings.Join(got, "\n") != "event: change\ndata: test.html" {
+		t.Errorf("Expecting change event for test.html, got %v", got)
+	}
+}
+
+// lockedKeyedExecutor allows templates to be updated while being watched for changes
+type lockedKeyedExecutor struct {
+	*KeyedStringExecutor
+	mu sync.Mutex
+}
+
+func (le *lockedKeyedExecutor) LoadTemplate(key string) (string, error) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.KeyedStringExecutor.LoadTemplate(key)
+}
+
+func (le *lockedKeyedExecutor) set(key, tmpl string) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.Templates[key] = tmpl
+}
+
+func TestLiveReloadWriter_Streamed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lw := &liveReloadWriter{ResponseWriter: rec}
+	lw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	lw.Write([]byte("<html><BODY>streamed</BO"))
+	lw.Flush()
+	if !rec.Flushed {
+		t.Error("Expecting the response to be flushed")
+	}
+	if got := rec.Body.String(); got != "<html><BODY>streamed" {
+		t.Errorf("Expecting a partial closing tag to be held back, got %s", got)
+	}
+	lw.Write([]byte("DY></html>"))
+	lw.finish()
+
+	expect := "<html><BODY>streamed" + string(liveReloadHook) + "</BODY></html>"
+	if got := rec.Body.String(); got != expect {
+		t.Errorf("Expecting page with live reload hook\n%s\ngot\n%s", expect, got)
+	}
+}
+
+func TestLiveReloadWriter_NotHTML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lw := &liveReloadWriter{ResponseWriter: rec}
+	lw.Header().Set("Content-Type", "text/plain")
+	lw.Write([]byte("text </body>"))
+	lw.finish()
+	if got := rec.Body.String(); got != "text </body>" {
+		t.Errorf("Expecting the body to be unchanged, got %s", got)
+	}
+}
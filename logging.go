@@ -0,0 +1,42 @@
+package treetop
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// logger returns the logger for the handler, the slog default logger is used if none was configured
+func (h *TemplateHandler) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
+
+// logResponse will log a message with attributes identifying the response, request and view
+func (h *TemplateHandler) logResponse(level slog.Level, msg string, rsp Response, req *http.Request, view *View, err error) {
+	attrs := responseAttrs(rsp, req, view)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	h.logger().LogAttrs(req.Context(), level, msg, attrs...)
+}
+
+// responseAttrs creates log attributes for the treetop response ID, the request path and
+// the template of the view being handled
+func responseAttrs(rsp Response, req *http.Request, view *View) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 5)
+	if rsp != nil {
+		attrs = append(attrs, slog.Uint64("response_id", uint64(rsp.ResponseID())))
+	}
+	if req != nil && req.URL != nil {
+		attrs = append(attrs, slog.String("path", req.URL.Path))
+	}
+	if view != nil {
+		attrs = append(attrs,
+			slog.String("template", view.Template),
+			slog.String("defines", view.Defines),
+		)
+	}
+	return attrs
+}
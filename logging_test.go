@@ -0,0 +1,157 @@
+package treetop
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestLogger creates a logger that writes JSON records to a buffer
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	return slog.New(slog.NewJSONHandler(buf, nil)), buf
+}
+
+// decodeLogRecords parses JSON log lines
+func decodeLogRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		rec := make(map[string]interface{})
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestTemplateHandler_LogTemplateError(t *testing.T) {
+	logger, buf := newTestLogger()
+	exec := &KeyedStringExecutor{
+		Templates: map[string]string{
+			"base.html":    `<div>{{ template "content" .Content }}</div>`,
+			"content.html": `<p>{{ .FAIL }}</p>`,
+		},
+		Logger: logger,
+	}
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", "content.html", Constant("data"))
+	handler := exec.NewViewHandler(content)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+
+	records := decodeLogRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expecting one log record, got %v", records)
+	}
+	got := records[0]
+	for key, expect := range map[string]interface{}{
+		"level":    "ERROR",
+		"msg":      "treetop: template handler error",
+		"path":     "/some/path",
+		"template": "content.html",
+		"defines":  "content",
+	} {
+		if got[key] != expect {
+			t.Errorf("Expecting log attribute %s to be %#v, got %#v", key, expect, got[key])
+		}
+	}
+	if _, ok := got["response_id"].(float64); !ok {
+		t.Errorf("Expecting a response_id attribute, got %#v", got["response_id"])
+	}
+	if got["error"] == nil {
+		t.Error("Expecting an error attribute")
+	}
+}
+
+func TestTemplateHandler_LogNotAcceptable(t *testing.T) {
+	logger, buf := newTestLogger()
+	exec := &StringExecutor{Logger: logger}
+	handler := exec.NewViewHandler(NewView(`<p>{{ . }}</p>`, Constant("data"))).FragmentOnly()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Expecting status %d, got %d", http.StatusNotAcceptable, rec.Code)
+	}
+
+	records := decodeLogRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expecting one log record, got %v", records)
+	}
+	if records[0]["level"] != "INFO" || records[0]["msg"] != "treetop: not acceptable" {
+		t.Errorf("Expecting not acceptable record, got %v", records[0])
+	}
+}
+
+func TestTemplateHandler_DefaultLogger(t *testing.T) {
+	th := &TemplateHandler{}
+	if th.logger() != slog.Default() {
+		t.Error("Expecting the slog default logger to be used")
+	}
+}
+
+func TestDeveloperExecutor_Logger(t *testing.T) {
+	logger, buf := newTestLogger()
+	keyed := NewKeyedStringExecutor(map[string]string{
+		"base.html":    `<div>{{ template "content" .Content }}</div>`,
+		"content.html": `<p>{{ .FAIL }}</p>`,
+	})
+	keyed.Logger = logger
+	exec := &DeveloperExecutor{keyed}
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", "content.html", Constant("data"))
+	handler := exec.NewViewHandler(content)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	for _, tt := range []struct {
+		accept   string
+		template string
+		defines  string
+	}{
+		{accept: "text/html", template: "base.html", defines: ""},
+		{accept: TemplateContentType, template: "content.html", defines: "content"},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, mockRequest("/some/path", tt.accept))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s: expecting status %d, got %d", tt.accept, http.StatusInternalServerError, rec.Code)
+		}
+		records := decodeLogRecords(t, buf)
+		if len(records) != 1 {
+			t.Fatalf("%s: expecting one log record, got %v", tt.accept, records)
+		}
+		for key, expect := range map[string]interface{}{
+			"level":    "ERROR",
+			"msg":      "DeveloperExecutor error",
+			"template": tt.template,
+			"defines":  tt.defines,
+		} {
+			if got := records[0][key]; got != expect {
+				t.Errorf("%s: expecting log attribute %s to be %#v, got %#v", tt.accept, key, expect, got)
+			}
+		}
+	}
+}
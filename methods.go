@@ -0,0 +1,69 @@
+package treetop
+
+import (
+	"net/http"
+	"strings"
+)
+
+// methodAllowed reports whether a request method is included in a list of allowed methods,
+// a HEAD request is allowed along with GET. An empty list allows all methods.
+func methodAllowed(allowed []string, method string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, m := range allowed {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == method || (m == http.MethodGet && method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeader formats the value of an Allow header for a list of allowed methods
+func allowHeader(allowed []string) string {
+	var methods []string
+	seen := make(map[string]bool)
+	add := func(m string) {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+	for _, m := range allowed {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		add(m)
+		if m == http.MethodGet {
+			add(http.MethodHead)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+// serveMethodNotAllowed writes a 405 response listing the allowed methods
+func serveMethodNotAllowed(w http.ResponseWriter, allowed []string) {
+	w.Header().Set("Allow", allowHeader(allowed))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// headResponseWriter is used to respond to a HEAD request, the response body is discarded
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write implements io.Writer, the content is discarded
+func (hw *headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Flush implements http.Flusher so that headers can be sent before the response is complete
+func (hw *headResponseWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer for use with http.ResponseController
+func (hw *headResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
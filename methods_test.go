@@ -0,0 +1,97 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func setupMethodsHandler() ViewHandler {
+	base := NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		rsp.Header().Set("X-Handled", req.Method)
+		return "Hello"
+	})
+	exec := StringExecutor{}
+	return exec.NewViewHandler(content)
+}
+
+func TestTemplateHandler_AllowMethods(t *testing.T) {
+	handler := setupMethodsHandler().AllowMethods("get", http.MethodPost)
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK},
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		for _, accept := range []string{"text/html", TemplateContentType} {
+			req := mockRequest("/some/path", accept)
+			req.Method = tt.method
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: expecting status %d, got %d", tt.method, accept, tt.status, rec.Code)
+			}
+			if tt.status != http.StatusMethodNotAllowed {
+				continue
+			}
+			if got := rec.Header().Get("Allow"); got != "GET, HEAD, POST" {
+				t.Errorf("%s %s: expecting Allow header %q, got %q", tt.method, accept, "GET, HEAD, POST", got)
+			}
+			if got := rec.Header().Get("X-Handled"); got != "" {
+				t.Errorf("%s %s: expecting handler not to be executed", tt.method, accept)
+			}
+		}
+	}
+}
+
+func TestTemplateHandler_AllowMethodsModifiers(t *testing.T) {
+	handler := setupMethodsHandler().AllowMethods(http.MethodPost)
+	for _, h := range []ViewHandler{handler.PageOnly(), handler.FragmentOnly()} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expecting status 405, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Allow"); got != "POST" {
+			t.Errorf("Expecting Allow header %q, got %q", "POST", got)
+		}
+	}
+}
+
+func TestTemplateHandler_HeadRequest(t *testing.T) {
+	handler := setupMethodsHandler()
+	for _, accept := range []string{"text/html", TemplateContentType} {
+		get := httptest.NewRecorder()
+		handler.ServeHTTP(get, mockRequest("/some/path", accept))
+
+		req := mockRequest("/some/path", accept)
+		req.Method = http.MethodHead
+		head := httptest.NewRecorder()
+		handler.ServeHTTP(head, req)
+
+		if head.Code != http.StatusOK {
+			t.Errorf("Accept %s: expecting status 200, got %d", accept, head.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("Accept %s: expecting an empty body, got %q", accept, head.Body)
+		}
+		if got := head.Header().Get("X-Handled"); got != http.MethodHead {
+			t.Errorf("Accept %s: expecting handler to be executed", accept)
+		}
+		for _, name := range []string{"Content-Length", "Content-Type", "Vary"} {
+			if got, expect := head.Header().Get(name), get.Header().Get(name); got != expect {
+				t.Errorf("Accept %s: expecting %s header %q, got %q", accept, name, expect, got)
+			}
+		}
+	}
+}
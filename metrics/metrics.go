@@ -0,0 +1,254 @@
+/*
+Package metrics records request counts, latencies and response sizes for treetop endpoints.
+
+The Collector is a treetop.Observer, it records every request served by a TemplateHandler
+once the response is complete, including error responses and redirects. It is also an http.Handler which serves the recorded metrics using
+the Prometheus text exposition format, so that it can be scraped without other dependencies.
+
+Example:
+
+	collector := &metrics.Collector{}
+	exec := treetop.FileExecutor{}
+
+	handler := exec.NewViewHandler(contentA).(*treetop.TemplateHandler)
+	handler.Observer = collector
+	mux.Handle("/some/path", handler)
+	mux.Handle("/metrics", collector)
+
+Metrics are labelled by the page template and the name defined by the partial view of the
+endpoint, so that page and fragment requests for an endpoint share the same labels, along
+with the request kind ("page" or "fragment") and the response status code.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rur/treetop"
+)
+
+// DefaultDurationBuckets are the upper bounds in seconds of the request duration histogram
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds in bytes of the response size histogram
+var DefaultSizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// ExpositionContentType is the content type of the metrics served by a Collector
+const ExpositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector records metrics for the treetop endpoints that it instruments. The zero value is
+// ready to use. Buckets must be set before any requests are recorded.
+type Collector struct {
+	// DurationBuckets are the upper bounds in seconds for request durations, see DefaultDurationBuckets
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds in bytes for response sizes, see DefaultSizeBuckets
+	SizeBuckets []float64
+
+	mu     sync.Mutex
+	series map[labels]*series
+}
+
+// labels identify a series of requests
+type labels struct {
+	template string
+	defines  string
+	kind     string
+	status   int
+}
+
+// series holds the metrics for one set of labels
+type series struct {
+	count    uint64
+	duration histogram
+	size     histogram
+}
+
+// histogram is a cumulative histogram of observed values
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+// observe records a value in each bucket with an upper bound not less than the value
+func (h *histogram) observe(value float64) {
+	h.sum += value
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// OnHandlerStart implements treetop.Observer, handler events are not recorded
+func (c *Collector) OnHandlerStart(treetop.ObserverEvent) {}
+
+// OnHandlerEnd implements treetop.Observer, handler events are not recorded
+func (c *Collector) OnHandlerEnd(treetop.ObserverEvent) {}
+
+// OnTemplateExecute implements treetop.Observer, template events are not recorded
+func (c *Collector) OnTemplateExecute(treetop.ObserverEvent) {}
+
+// OnWrite implements treetop.Observer, the request is recorded using the page template
+// and the name defined by the endpoint view
+func (c *Collector) OnWrite(ev treetop.ObserverEvent) {
+	if ev.View == nil {
+		return
+	}
+	root := ev.View
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	c.Record(root.Template, ev.View.Defines, ev.Fragment, ev.Status, ev.Elapsed, ev.Bytes)
+}
+
+// Record adds a request to the metrics
+func (c *Collector) Record(template, defines string, fragment bool, status int, duration time.Duration, size int64) {
+	key := labels{
+		template: template,
+		defines:  defines,
+		kind:     "page",
+		status:   status,
+	}
+	if fragment {
+		key.kind = "fragment"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.series == nil {
+		c.series = make(map[labels]*series)
+	}
+	s, ok := c.series[key]
+	if !ok {
+		durationBuckets, sizeBuckets := c.DurationBuckets, c.SizeBuckets
+		if durationBuckets == nil {
+			durationBuckets = DefaultDurationBuckets
+		}
+		if sizeBuckets == nil {
+			sizeBuckets = DefaultSizeBuckets
+		}
+		s = &series{
+			duration: newHistogram(durationBuckets),
+			size:     newHistogram(sizeBuckets),
+		}
+		c.series[key] = s
+	}
+	s.count++
+	s.duration.observe(duration.Seconds())
+	s.size.observe(float64(size))
+}
+
+// ServeHTTP will write the metrics using the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ExpositionContentType)
+	if _, err := c.WriteTo(w); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// WriteTo will write the metrics using the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	keys := make([]labels, 0, len(c.series))
+	snapshot := make(map[labels]series, len(c.series))
+	for key, s := range c.series {
+		keys = append(keys, key)
+		snapshot[key] = series{
+			count:    s.count,
+			duration: s.duration.copy(),
+			size:     s.size.copy(),
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.template != b.template {
+			return a.template < b.template
+		}
+		if a.defines != b.defines {
+			return a.defines < b.defines
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.status < b.status
+	})
+
+	var out strings.Builder
+	out.WriteString("# HELP treetop_requests_total Total number of requests handled by treetop endpoints.\n")
+	out.WriteString("# TYPE treetop_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&out, "treetop_requests_total{%s} %d\n", key.format(), snapshot[key].count)
+	}
+	out.WriteString("# HELP treetop_request_duration_seconds Time taken to serve treetop requests.\n")
+	out.WriteString("# TYPE treetop_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		s := snapshot[key]
+		s.duration.write(&out, "treetop_request_duration_seconds", key, s.count)
+	}
+	out.WriteString("# HELP treetop_response_size_bytes Size of treetop response bodies.\n")
+	out.WriteString("# TYPE treetop_response_size_bytes histogram\n")
+	for _, key := range keys {
+		s := snapshot[key]
+		s.size.write(&out, "treetop_response_size_bytes", key, s.count)
+	}
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+// copy creates a histogram that does not share bucket counts
+func (h histogram) copy() histogram {
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	h.counts = counts
+	return h
+}
+
+// write outputs the bucket, sum and count lines for a histogram
+func (h histogram) write(out *strings.Builder, name string, key labels, count uint64) {
+	lbls := key.format()
+	for i, bound := range h.bounds {
+		fmt.Fprintf(out, "%s_bucket{%s,le=%q} %d\n", name, lbls, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(out, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, lbls, count)
+	fmt.Fprintf(out, "%s_sum{%s} %s\n", name, lbls, formatFloat(h.sum))
+	fmt.Fprintf(out, "%s_count{%s} %d\n", name, lbls, count)
+}
+
+// format the labels for the exposition format
+func (l labels) format() string {
+	return fmt.Sprintf(
+		`template="%s",defines="%s",kind="%s",status="%d"`,
+		escapeLabel(l.template), escapeLabel(l.defines), l.kind, l.status,
+	)
+}
+
+// escapeLabel escapes a label value, as required by the exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value for the exposition format
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rur/treetop"
+)
+
+func setupCollector() (*Collector, *treetop.TemplateHandler) {
+	base := treetop.NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp treetop.Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewSubView("content", `<p>{{ . }}</p>`, treetop.Constant("Hello"))
+
+	exec := treetop.StringExecutor{}
+	collector := &Collector{
+		DurationBuckets: []float64{60},
+		SizeBuckets:     []float64{10, 100},
+	}
+	handler := exec.NewViewHandler(content).(*treetop.TemplateHandler)
+	handler.Observer = collector
+	return collector, handler
+}
+
+func TestCollector_Observer(t *testing.T) {
+	collector, handler := setupCollector()
+
+	for _, accept := range []string{"text/html", "text/html", treetop.TemplateContentType} {
+		req := httptest.NewRequest("GET", "/some/path", nil)
+		req.Header.Set("Accept", accept)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest("GET", "/some/path", nil)
+	req.Header.Set("Accept", "text/html")
+	handler.FragmentOnly().ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != ExpositionContentType {
+		t.Errorf("Expecting content type %s, got %s", ExpositionContentType, got)
+	}
+	got := rec.Body.String()
+	const page = `template="<div>{{ template \"content\" .Content }}</div>",defines="content",kind="page"`
+	const fragment = `template="<div>{{ template \"content\" .Content }}</div>",defines="content",kind="fragment"`
+	for _, line := range []string{
+		"# TYPE treetop_requests_total counter",
+		`treetop_requests_total{` + fragment + `,status="200"} 1`,
+		`treetop_requests_total{` + page + `,status="200"} 2`,
+		"# TYPE treetop_request_duration_seconds histogram",
+		`treetop_request_duration_seconds_bucket{` + page + `,status="200",le="60"} 2`,
+		`treetop_request_duration_seconds_bucket{` + page + `,status="200",le="+Inf"} 2`,
+		`treetop_request_duration_seconds_count{` + page + `,status="200"} 2`,
+		"# TYPE treetop_response_size_bytes histogram",
+		`treetop_response_size_bytes_bucket{` + page + `,status="200",le="10"} 0`,
+		`treetop_response_size_bytes_bucket{` + page + `,status="200",le="100"} 2`,
+		`treetop_response_size_bytes_sum{` + page + `,status="200"} 46`,
+		`treetop_response_size_bytes_count{` + fragment + `,status="200"} 1`,
+		`treetop_requests_total{` + page + `,status="406"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Expecting metrics to contain line %s, got\n%s", line, got)
+		}
+	}
+}
+
+func TestCollector_ErrorResponses(t *testing.T) {
+	collector, handler := setupCollector()
+	handler.Partial.HandlerFunc = func(rsp treetop.Response, req *http.Request) interface{} {
+		if req.URL.Query().Get("redirect") != "" {
+			treetop.Redirect(rsp, req, "/other", http.StatusSeeOther)
+			return nil
+		}
+		panic("something went wrong")
+	}
+	handler.Page.SubViews["content"].HandlerFunc = handler.Partial.HandlerFunc
+
+	for _, path := range []string{"/some/path", "/some/path?redirect=1"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/html")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest("POST", "/some/path", nil)
+	req.Header.Set("Accept", treetop.TemplateContentType)
+	handler.AllowMethods("GET").ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+	const lbls = `template="<div>{{ template \"content\" .Content }}</div>",defines="content"`
+	for _, line := range []string{
+		`treetop_requests_total{` + lbls + `,kind="page",status="500"} 1`,
+		`treetop_requests_total{` + lbls + `,kind="page",status="303"} 1`,
+		`treetop_requests_total{` + lbls + `,kind="fragment",status="405"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Expecting metrics to contain line %s, got\n%s", line, got)
+		}
+	}
+}
+
+func TestCollector_Record(t *testing.T) {
+	collector := &Collector{}
+	collector.Record("base\n\"1\"", "", false, http.StatusOK, 30*time.Millisecond, 2000)
+
+	var out strings.Builder
+	if _, err := collector.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	const lbls = `template="base\n\"1\"",defines="",kind="page",status="200"`
+	for _, line := range []string{
+		`treetop_requests_total{` + lbls + `} 1`,
+		`treetop_request_duration_seconds_bucket{` + lbls + `,le="0.025"} 0`,
+		`treetop_request_duration_seconds_bucket{` + lbls + `,le="0.05"} 1`,
+		`treetop_request_duration_seconds_sum{` + lbls + `} 0.03`,
+		`treetop_response_size_bytes_bucket{` + lbls + `,le="1024"} 0`,
+		`treetop_response_size_bytes_bucket{` + lbls + `,le="4096"} 1`,
+		`treetop_response_size_bytes_sum{` + lbls + `} 2000`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Expecting metrics to contain line %s, got\n%s", line, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package treetop
+
+import (
+	"net/http"
+	"time"
+)
+
+// Observer receives notifications as a TemplateHandler serves a request, this can be
+// used to record timings for tracing and metrics.
+//
+// Sub view handlers can be executed concurrently, so implementations must be safe
+// for concurrent use.
+type Observer interface {
+	// OnHandlerStart is called before the handler function of a view is invoked
+	OnHandlerStart(ObserverEvent)
+	// OnHandlerEnd is called when a handler function returns, the duration includes
+	// the time spent in any sub view handlers that it invoked
+	OnHandlerEnd(ObserverEvent)
+	// OnTemplateExecute is called when a view template has been executed
+	OnTemplateExecute(ObserverEvent)
+	// OnWrite is called once for every response when the handler has completed, including
+	// error responses, redirects written by a view handler and aborted responses
+	OnWrite(ObserverEvent)
+}
+
+// ObserverEvent describes a stage in the handling of a treetop response
+type ObserverEvent struct {
+	Request *http.Request
+	// ResponseID is the ID of the treetop response, see Response.ResponseID
+	ResponseID uint32
+	// Fragment is true for a template request, false for a full page request
+	Fragment bool
+	// View is the view of the handler or template, for write events it is the partial view
+	// of the endpoint, or the page view when the handler does not serve fragments
+	View *View
+	// Duration is the time taken by the stage, zero for handler start events. For write
+	// events it is the time since the response headers were written
+	Duration time.Duration
+	// Elapsed is the time since the response began, it is only set for write events
+	Elapsed time.Duration
+	// Bytes is the size of the template output or of the response body written
+	Bytes int64
+	// Status is the response status code for write events
+	Status int
+	// Err is the template or write error, if any. For write events it is
+	// http.ErrAbortHandler when the response was aborted by a panic
+	Err error
+}
+
+// newObserverEvent creates an event for the current response
+func (rsp *ResponseWrapper) newObserverEvent(req *http.Request, view *View) ObserverEvent {
+	return ObserverEvent{
+		Request:    req,
+		ResponseID: rsp.responseID,
+		Fragment:   rsp.fragment,
+		View:       view,
+	}
+}
+
+// observeHandler will notify the observer that a view handler has started, the returned
+// function must be called when the handler has completed.
+func (rsp *ResponseWrapper) observeHandler(req *http.Request, view *View) func() {
+	if rsp.observer == nil {
+		return func() {}
+	}
+	start := time.Now()
+	rsp.observer.OnHandlerStart(rsp.newObserverEvent(req, view))
+	return func() {
+		ev := rsp.newObserverEvent(req, view)
+		ev.Duration = time.Since(start)
+		rsp.observer.OnHandlerEnd(ev)
+	}
+}
+
+// observeTemplate will notify the observer that a view template was executed
+func (rsp *ResponseWrapper) observeTemplate(req *http.Request, view *View, start time.Time, n int, err error) {
+	if rsp.observer == nil {
+		return
+	}
+	ev := rsp.newObserverEvent(req, view)
+	ev.Duration = time.Since(start)
+	ev.Bytes = int64(n)
+	ev.Err = err
+	rsp.observer.OnTemplateExecute(ev)
+}
+
+// observedWriter records the outcome of a response for the write event of an observer
+type observedWriter struct {
+	http.ResponseWriter
+	status int
+	// started is the time that the response headers were written
+	started time.Time
+	written int64
+	err     error
+}
+
+// WriteHeader implements http.ResponseWriter
+func (ow *observedWriter) WriteHeader(status int) {
+	if ow.status == 0 && status >= http.StatusOK {
+		ow.status = status
+		ow.started = time.Now()
+	}
+	ow.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (ow *observedWriter) Write(p []byte) (int, error) {
+	if ow.status == 0 {
+		ow.status = http.StatusOK
+		ow.started = time.Now()
+	}
+	n, err := ow.ResponseWriter.Write(p)
+	ow.written += int64(n)
+	if err != nil && ow.err == nil {
+		ow.err = err
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher, headers are sent with a 200 status if none was written
+func (ow *observedWriter) Flush() {
+	if ow.status == 0 {
+		ow.status = http.StatusOK
+		ow.started = time.Now()
+	}
+	if f, ok := ow.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying response writer for use with http.ResponseController
+func (ow *observedWriter) Unwrap() http.ResponseWriter {
+	return ow.ResponseWriter
+}
+
+// observeWrite will notify the observer of the outcome of a response once the handler has
+// returned. A response that did not complete, due to a panic, is reported with an
+// http.ErrAbortHandler error and a 500 status if no status was written.
+func (rsp *ResponseWrapper) observeWrite(req *http.Request, view *View, ow *observedWriter, completed bool) {
+	if rsp.observer == nil {
+		return
+	}
+	ev := rsp.newObserverEvent(req, view)
+	ev.Elapsed = time.Since(rsp.began)
+	if !ow.started.IsZero() {
+		ev.Duration = time.Since(ow.started)
+	}
+	ev.Bytes = ow.written
+	ev.Status = ow.status
+	ev.Err = ow.err
+	if !completed {
+		if ev.Status == 0 {
+			ev.Status = http.StatusInternalServerError
+		}
+		if ev.Err == nil {
+			ev.Err = http.ErrAbortHandler
+		}
+	}
+	if ev.Status == 0 {
+		// net/http sends a 200 status for a handler which does not write a response
+		ev.Status = http.StatusOK
+	}
+	rsp.observer.OnWrite(ev)
+}
@@ -0,0 +1,246 @@
+package treetop
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingObserver keeps a log of observer events
+type recordingObserver struct {
+	mu     sync.Mutex
+	log    []string
+	events []ObserverEvent
+}
+
+func (o *recordingObserver) record(name string, ev ObserverEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	view := "nil"
+	if ev.View != nil {
+		view = ev.View.Template
+	}
+	o.log = append(o.log, fmt.Sprintf("%s %s", name, view))
+	o.events = append(o.events, ev)
+}
+
+func (o *recordingObserver) OnHandlerStart(ev ObserverEvent)    { o.record("start", ev) }
+func (o *recordingObserver) OnHandlerEnd(ev ObserverEvent)      { o.record("end", ev) }
+func (o *recordingObserver) OnTemplateExecute(ev ObserverEvent) { o.record("template", ev) }
+func (o *recordingObserver) OnWrite(ev ObserverEvent)           { o.record("write", ev) }
+
+func setupObservedHandler() (*TemplateHandler, *recordingObserver) {
+	base := NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content := base.NewDefaultSubView("content", `<p>{{ . }}</p>`, Constant("Hello"))
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(content).(*TemplateHandler)
+	obs := &recordingObserver{}
+	th.Observer = obs
+	return th, obs
+}
+
+func TestTemplateHandler_ObserverPageRequest(t *testing.T) {
+	th, obs := setupObservedHandler()
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	expect := []string{
+		`start <div>{{ template "content" .Content }}</div>`,
+		`start <p>{{ . }}</p>`,
+		`end <p>{{ . }}</p>`,
+		`end <div>{{ template "content" .Content }}</div>`,
+		`template <div>{{ template "content" .Content }}</div>`,
+		`write <p>{{ . }}</p>`,
+	}
+	if !reflect.DeepEqual(obs.log, expect) {
+		t.Errorf("Expecting events %v, got %v", expect, obs.log)
+	}
+	for _, ev := range obs.events {
+		if ev.Fragment {
+			t.Error("Expecting a page request event")
+		}
+		if ev.Request == nil || ev.Request.URL.Path != "/some/path" {
+			t.Errorf("Expecting event to include the request")
+		}
+	}
+	tmpl := obs.events[4]
+	if tmpl.Bytes != int64(rec.Body.Len()) || tmpl.Err != nil {
+		t.Errorf("Expecting template event with %d bytes, got %d, error %v", rec.Body.Len(), tmpl.Bytes, tmpl.Err)
+	}
+	write := obs.events[5]
+	if write.Bytes != int64(rec.Body.Len()) || write.Status != http.StatusOK {
+		t.Errorf("Expecting write event with %d bytes and status 200, got %d bytes status %d", rec.Body.Len(), write.Bytes, write.Status)
+	}
+	if write.Elapsed < write.Duration {
+		t.Errorf("Expecting elapsed time of the response to include the write, got %s < %s", write.Elapsed, write.Duration)
+	}
+	if write.ResponseID != obs.events[0].ResponseID {
+		t.Errorf("Expecting events to share a response ID, got %d and %d", write.ResponseID, obs.events[0].ResponseID)
+	}
+}
+
+func TestTemplateHandler_ObserverTemplateRequest(t *testing.T) {
+	th, obs := setupObservedHandler()
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+
+	expect := []string{
+		`start <p>{{ . }}</p>`,
+		`end <p>{{ . }}</p>`,
+		`template <p>{{ . }}</p>`,
+		`write <p>{{ . }}</p>`,
+	}
+	if !reflect.DeepEqual(obs.log, expect) {
+		t.Errorf("Expecting events %v, got %v", expect, obs.log)
+	}
+	for _, ev := range obs.events {
+		if !ev.Fragment {
+			t.Error("Expecting a fragment request event")
+		}
+	}
+	if tmpl := obs.events[2]; tmpl.Bytes != int64(len("<p>Hello</p>")) {
+		t.Errorf("Expecting template output of %d bytes, got %d", len("<p>Hello</p>"), tmpl.Bytes)
+	}
+	if write := obs.events[3]; write.Bytes != int64(rec.Body.Len()) {
+		t.Errorf("Expecting %d bytes written, got %d", rec.Body.Len(), write.Bytes)
+	}
+}
+
+func TestTemplateHandler_ObserverStreamPage(t *testing.T) {
+	th, obs := setupObservedHandler()
+	th.StreamPage = true
+	th.ConcurrentSubViews = true
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	if len(obs.log) != 6 {
+		t.Fatalf("Expecting 6 events, got %v", obs.log)
+	}
+	if last := obs.events[5]; obs.log[5] != `write <p>{{ . }}</p>` || last.Bytes != int64(rec.Body.Len()) {
+		t.Errorf("Expecting a final write event of %d bytes, got %s with %d bytes", rec.Body.Len(), obs.log[5], last.Bytes)
+	}
+}
+
+func TestTemplateHandler_ObserverWriteOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(th *TemplateHandler)
+		handler ViewHandlerFunc
+		method  string
+		accept  string
+		status  int
+		err     error
+	}{
+		{
+			name:   "template error",
+			accept: "text/html",
+			setup: func(th *TemplateHandler) {
+				th.PageTemplate = template.Must(template.New("").Parse(`{{ template "missing" . }}`))
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "not acceptable",
+			accept: "text/html",
+			setup: func(th *TemplateHandler) {
+				th.Page = nil
+			},
+			status: http.StatusNotAcceptable,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			accept: TemplateContentType,
+			setup: func(th *TemplateHandler) {
+				th.AllowedMethods = []string{http.MethodGet}
+			},
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "redirect",
+			accept: "text/html",
+			handler: func(rsp Response, req *http.Request) interface{} {
+				Redirect(rsp, req, "/other", http.StatusSeeOther)
+				return nil
+			},
+			status: http.StatusSeeOther,
+		},
+		{
+			name:   "handler panic",
+			accept: "text/html",
+			handler: func(rsp Response, req *http.Request) interface{} {
+				panic("something went wrong")
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "handler panic after writing",
+			accept: TemplateContentType,
+			handler: func(rsp Response, req *http.Request) interface{} {
+				rsp.WriteHeader(http.StatusAccepted)
+				panic("something went wrong")
+			},
+			status: http.StatusAccepted,
+			err:    http.ErrAbortHandler,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, obs := setupObservedHandler()
+			if tt.setup != nil {
+				tt.setup(th)
+			}
+			if tt.handler != nil {
+				th.Partial.HandlerFunc = tt.handler
+				th.Page.SubViews["content"].HandlerFunc = tt.handler
+			}
+			req := mockRequest("/some/path", tt.accept)
+			if tt.method != "" {
+				req.Method = tt.method
+			}
+			rec := httptest.NewRecorder()
+			func() {
+				defer func() {
+					if r := recover(); r != nil && r != http.ErrAbortHandler {
+						panic(r)
+					}
+				}()
+				th.ServeHTTP(rec, req)
+			}()
+
+			var writes []ObserverEvent
+			for i, entry := range obs.log {
+				if strings.HasPrefix(entry, "write ") {
+					writes = append(writes, obs.events[i])
+				}
+			}
+			if len(writes) != 1 {
+				t.Fatalf("Expecting one write event, got %v", obs.log)
+			}
+			ev := writes[0]
+			if ev.Status != tt.status {
+				t.Errorf("Expecting write event with status %d, got %d", tt.status, ev.Status)
+			}
+			if ev.Err != tt.err {
+				t.Errorf("Expecting write event error %v, got %v", tt.err, ev.Err)
+			}
+			if ev.View != th.Partial {
+				t.Errorf("Expecting write event for the partial view, got %s", SprintViewInfo(ev.View))
+			}
+			if ev.Bytes != int64(rec.Body.Len()) {
+				t.Errorf("Expecting write event of %d bytes, got %d", rec.Body.Len(), ev.Bytes)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package treetop
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
@@ -16,13 +17,9 @@ func SprintViewInfo(v *View) string {
 	if v == nil {
 		return "nil"
 	}
-	handlerInfo := "nil"
-	if v.HandlerFunc != nil {
-		handlerInfo = runtime.
-			FuncForPC(reflect.
-				ValueOf(v.HandlerFunc).
-				Pointer()).
-			Name()
+	handlerInfo := handlerName(v)
+	if handlerInfo == "" {
+		handlerInfo = "nil"
 	}
 	if v.Defines == "" {
 		return fmt.Sprintf(
@@ -39,6 +36,15 @@ func SprintViewInfo(v *View) string {
 	)
 }
 
+// handlerName returns the name of the view handler function, an empty string is
+// returned if the view has no handler
+func handlerName(v *View) string {
+	if v.HandlerFunc == nil {
+		return ""
+	}
+	return runtime.FuncForPC(reflect.ValueOf(v.HandlerFunc).Pointer()).Name()
+}
+
 // previewString previews an arbitrary string on a single line.
 // All whitespace will be stripped and it will be quoted and escaped.
 // A middle ellipsis will be inserted if the string is too long.
@@ -130,3 +136,169 @@ func fprintViewTree(w io.Writer, prefix []byte, views map[string]*View) {
 		}
 	}
 }
+
+// ViewTreeNode is a machine-readable description of a view hierarchy, see ViewTree
+type ViewTreeNode struct {
+	Template string `json:"template"`
+	Defines  string `json:"defines,omitempty"`
+	// Handler is the name of the view handler function, empty if there is none
+	Handler string `json:"handler,omitempty"`
+	// SubViews are keyed by block name, a nil node is a block without a sub view
+	SubViews map[string]*ViewTreeNode `json:"subViews,omitempty"`
+}
+
+// ViewTree creates a description of a view hierarchy, the handler name is found in the
+// same way as SprintViewInfo. A nil view results in a nil node.
+func ViewTree(v *View) *ViewTreeNode {
+	if v == nil {
+		return nil
+	}
+	node := &ViewTreeNode{
+		Template: v.Template,
+		Defines:  v.Defines,
+		Handler:  handlerName(v),
+	}
+	if len(v.SubViews) > 0 {
+		node.SubViews = make(map[string]*ViewTreeNode, len(v.SubViews))
+		for name, sub := range v.SubViews {
+			node.SubViews[name] = ViewTree(sub)
+		}
+	}
+	return node
+}
+
+// sortedSubViews returns the block names of the node in order
+func (n *ViewTreeNode) sortedSubViews() []string {
+	names := make([]string, 0, len(n.SubViews))
+	for name := range n.SubViews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SprintViewTreeJSON creates an indented JSON document describing a view hierarchy,
+// see ViewTreeNode.
+//
+// For example
+//
+//	{
+//	  "template": "base.html",
+//	  "handler": "github.com/rur/treetop.Constant.func1",
+//	  "subViews": {
+//	    "A": {
+//	      "template": "A.html",
+//	      "defines": "A",
+//	      "handler": "github.com/rur/treetop.Constant.func1"
+//	    }
+//	  }
+//	}
+func SprintViewTreeJSON(v *View) string {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ViewTree(v)); err != nil {
+		// a view tree contains only strings and maps
+		panic(err)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// SprintViewTreeDOT creates a Graphviz DOT digraph of a view hierarchy. Each view is a node
+// labeled with the template and handler, edges to sub views are labeled with the block name.
+// Blocks without a sub view are drawn as dashed nodes.
+//
+// For example
+//
+//	digraph views {
+//	  node [shape=box];
+//	  v0 [label="base.html\ngithub.com/rur/treetop.Constant.func1"];
+//	  v1 [label="A.html\ngithub.com/rur/treetop.Constant.func1"];
+//	  v0 -> v1 [label="A"];
+//	}
+func SprintViewTreeDOT(v *View) string {
+	var sb strings.Builder
+	sb.WriteString("digraph views {\n  node [shape=box];\n")
+	var next int
+	var walk func(node *ViewTreeNode) int
+	walk = func(node *ViewTreeNode) int {
+		id := next
+		next++
+		if node == nil {
+			fmt.Fprintf(&sb, "  v%d [label=\"nil\", style=dashed];\n", id)
+			return id
+		}
+		label := node.Template + "\n" + orNil(node.Handler)
+		fmt.Fprintf(&sb, "  v%d [label=%s];\n", id, dotQuote(label))
+		for _, name := range node.sortedSubViews() {
+			sub := walk(node.SubViews[name])
+			fmt.Fprintf(&sb, "  v%d -> v%d [label=%s];\n", id, sub, dotQuote(name))
+		}
+		return id
+	}
+	walk(ViewTree(v))
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// SprintViewTreeMermaid creates a Mermaid flowchart of a view hierarchy. Each view is a node
+// labeled with the template and handler, edges to sub views are labeled with the block name.
+//
+// For example
+//
+//	flowchart TD
+//	  v0["base.html<br/>github.com/rur/treetop.Constant.func1"]
+//	  v1["A.html<br/>github.com/rur/treetop.Constant.func1"]
+//	  v0 -->|"A"| v1
+func SprintViewTreeMermaid(v *View) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	var next int
+	var walk func(node *ViewTreeNode) int
+	walk = func(node *ViewTreeNode) int {
+		id := next
+		next++
+		if node == nil {
+			fmt.Fprintf(&sb, "  v%d[\"nil\"]\n", id)
+			return id
+		}
+		fmt.Fprintf(&sb, "  v%d[\"%s<br/>%s\"]\n", id,
+			mermaidEscape(node.Template),
+			mermaidEscape(orNil(node.Handler)))
+		for _, name := range node.sortedSubViews() {
+			sub := walk(node.SubViews[name])
+			fmt.Fprintf(&sb, "  v%d -->|\"%s\"| v%d\n", id, mermaidEscape(name), sub)
+		}
+		return id
+	}
+	walk(ViewTree(v))
+	return sb.String()
+}
+
+// orNil substitutes "nil" for an empty string
+func orNil(s string) string {
+	if s == "" {
+		return "nil"
+	}
+	return s
+}
+
+// dotQuote creates a DOT string literal, a newline is a centered line break
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// mermaidEscape replaces characters that cannot appear in a quoted Mermaid label
+// with entity codes, a newline is a line break
+var mermaidEscape = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"\r", "",
+	"\n", "<br/>",
+).Replace
@@ -201,7 +201,7 @@ func TestSprintViewTree(t *testing.T) {
 // helpers
 // -----------
 
-var funNamePattern = regexp.MustCompile(`github\.com/rur/treet[\w\d.…/]*\.func\d+`)
+var funNamePattern = regexp.MustCompile(`github\.com/rur/treet[\w\d.…/]*\.(func)?\d+`)
 
 // normalizeTreePrint will trim whitespace from test assertions
 // and account for indentation in multiline raw strings.
@@ -286,3 +286,73 @@ var fromExampleDotCom = `
 </body>
 </html>
 `
+
+func setupExportViews() *View {
+	v := NewView("base.html", Constant("base!"))
+	a := v.NewDefaultSubView("A", "<p class=\"a\">\n  {{ . }}\n</p>", Constant("A!"))
+	a.NewDefaultSubView("A1", "A1.html", nil)
+	v.NewSubView("B", "B.html", Constant("B!"))
+	return v
+}
+
+func TestSprintViewTreeJSON(t *testing.T) {
+	got := SprintViewTreeJSON(setupExportViews())
+	expect := `{
+  "template": "base.html",
+  "handler": "github.com/rur/treetop.Constant.func1",
+  "subViews": {
+    "A": {
+      "template": "<p class=\"a\">\n  {{ . }}\n</p>",
+      "defines": "A",
+      "handler": "github.com/rur/treetop.Constant.func1",
+      "subViews": {
+        "A1": {
+          "template": "A1.html",
+          "defines": "A1"
+        }
+      }
+    },
+    "B": null
+  }
+}`
+	if got != expect {
+		t.Errorf("Expecting JSON\n%s\nGOT\n%s", expect, got)
+	}
+	if got := SprintViewTreeJSON(nil); got != "null" {
+		t.Errorf("Expecting null for a nil view, got %s", got)
+	}
+}
+
+func TestSprintViewTreeDOT(t *testing.T) {
+	got := SprintViewTreeDOT(setupExportViews())
+	expect := `digraph views {
+  node [shape=box];
+  v0 [label="base.html\ngithub.com/rur/treetop.Constant.func1"];
+  v1 [label="<p class=\"a\">\n  {{ . }}\n</p>\ngithub.com/rur/treetop.Constant.func1"];
+  v2 [label="A1.html\nnil"];
+  v1 -> v2 [label="A1"];
+  v0 -> v1 [label="A"];
+  v3 [label="nil", style=dashed];
+  v0 -> v3 [label="B"];
+}
+`
+	if got != expect {
+		t.Errorf("Expecting DOT\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestSprintViewTreeMermaid(t *testing.T) {
+	got := SprintViewTreeMermaid(setupExportViews())
+	expect := `flowchart TD
+  v0["base.html<br/>github.com/rur/treetop.Constant.func1"]
+  v1["#lt;p class=#quot;a#quot;#gt;<br/>  {{ . }}<br/>#lt;/p#gt;<br/>github.com/rur/treetop.Constant.func1"]
+  v2["A1.html<br/>nil"]
+  v1 -->|"A1"| v2
+  v0 -->|"A"| v1
+  v3["nil"]
+  v0 -->|"B"| v3
+`
+	if got != expect {
+		t.Errorf("Expecting Mermaid\n%s\nGOT\n%s", expect, got)
+	}
+}
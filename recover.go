@@ -0,0 +1,83 @@
+package treetop
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// HandlerPanic is the error created when a view handler function panics while
+// serving a request. It records the view of the failing handler and the stack at the
+// point of the panic.
+type HandlerPanic struct {
+	View  *View
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements the error interface
+func (hp *HandlerPanic) Error() string {
+	if hp == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("panic in handler for %s: %v", SprintViewInfo(hp.View), hp.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (hp *HandlerPanic) Unwrap() error {
+	if hp == nil {
+		return nil
+	}
+	err, _ := hp.Value.(error)
+	return err
+}
+
+// recoverHandlerPanic must be deferred by the caller of a view handler function, a panic will be
+// converted into a *HandlerPanic for the view. The panic will continue with the new value
+// so that it can be handled by the TemplateHandler.
+func recoverHandlerPanic(view *View) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(*HandlerPanic); ok || r == http.ErrAbortHandler {
+		// already handled by a nested view, or the handler is deliberately aborting
+		panic(r)
+	}
+	panic(&HandlerPanic{
+		View:  view,
+		Value: r,
+		Stack: debug.Stack(),
+	})
+}
+
+// serveHandlerPanic will deal with a value recovered while serving a request. Handler panics
+// are routed through the response error handler unless the response has already been
+// written, in which case the connection will be aborted.
+func (h *TemplateHandler) serveHandlerPanic(resp *ResponseWrapper, req *http.Request, r interface{}) {
+	hp, ok := r.(*HandlerPanic)
+	if !ok {
+		panic(r)
+	}
+	if resp.hijacked || resp.Finished() {
+		h.logger().LogAttrs(req.Context(), slog.LevelError, "treetop: handler panic after response was written",
+			append(responseAttrs(resp, req, hp.View),
+				slog.Any("error", hp),
+				slog.String("stack", string(hp.Stack)),
+			)...,
+		)
+		panic(http.ErrAbortHandler)
+	}
+	h.newResponseErrorLog(resp, req, hp.View)(hp)
+}
+
+// panicStack will obtain the stack trace of a handler panic from an error, if present
+func panicStack(err error) string {
+	var hp *HandlerPanic
+	if errors.As(err, &hp) {
+		return string(hp.Stack)
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package treetop
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setupPanicHandler(panicValue interface{}) (base, content *View) {
+	base = NewView(`<div>{{ template "content" .Content }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	content = base.NewDefaultSubView("content", `<p>{{ . }}</p>`, func(rsp Response, req *http.Request) interface{} {
+		panic(panicValue)
+	})
+	return base, content
+}
+
+func TestTemplateHandler_HandlerPanic(t *testing.T) {
+	base, content := setupPanicHandler("something bad")
+	exec := StringExecutor{}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+
+	var got error
+	th.ServeTemplateError = func(err error, rsp Response, req *http.Request) {
+		got = err
+		http.Error(rsp, "Custom Error", http.StatusInternalServerError)
+	}
+
+	for _, accept := range []string{"text/html", TemplateContentType} {
+		got = nil
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, mockRequest("/some/path", accept))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Accept %s: expecting status %d, got %d", accept, http.StatusInternalServerError, rec.Code)
+		}
+		if body := strings.TrimSpace(sDumpBody(rec)); body != "Custom Error" {
+			t.Errorf("Accept %s: expecting error to be served by ServeTemplateError, got %s", accept, body)
+		}
+		var hp *HandlerPanic
+		if !errors.As(got, &hp) {
+			t.Fatalf("Accept %s: expecting a *HandlerPanic error, got %#v", accept, got)
+		}
+		if hp.View.Defines != content.Defines || hp.View.Template != content.Template {
+			t.Errorf("Accept %s: expecting panic for the content view, got %s", accept, SprintViewInfo(hp.View))
+		}
+		if hp.Value != "something bad" {
+			t.Errorf("Accept %s: expecting panic value, got %#v", accept, hp.Value)
+		}
+		if !strings.Contains(string(hp.Stack), "setupPanicHandler") {
+			t.Errorf("Accept %s: expecting stack to include the handler that panicked, got\n%s", accept, hp.Stack)
+		}
+		expect := `panic in handler for SubView("content", "<p>{{.}}</p>", ` +
+			`github.com/rur/treetop.setupPanicHandler.func2): something bad`
+		if got.Error() != expect {
+			t.Errorf("Accept %s: expecting error message %s, got %s", accept, expect, got)
+		}
+	}
+}
+
+func TestTemplateHandler_HandlerPanicDefaultError(t *testing.T) {
+	base, _ := setupPanicHandler(errors.New("something bad"))
+	exec := StringExecutor{}
+	handler := exec.NewViewHandler(base)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if body := strings.TrimSpace(sDumpBody(rec)); body != "Internal Server Error" {
+		t.Errorf("Expecting default error response, got %s", body)
+	}
+}
+
+func TestTemplateHandler_HandlerPanicConcurrent(t *testing.T) {
+	errBad := errors.New("something bad")
+	base, content := setupPanicHandler(errBad)
+	exec := StringExecutor{}
+	base.HandlerFunc = func(rsp Response, req *http.Request) interface{} {
+		PrefetchSubViews(rsp, req)
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	}
+	th := exec.NewViewHandler(base).(*TemplateHandler)
+	th.ConcurrentSubViews = true
+
+	var got error
+	th.ServeTemplateError = func(err error, rsp Response, req *http.Request) {
+		got = err
+		rsp.WriteHeader(http.StatusInternalServerError)
+	}
+	rec := httptest.NewRecorder()
+	th.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+
+	var hp *HandlerPanic
+	if !errors.As(got, &hp) {
+		t.Fatalf("Expecting a *HandlerPanic error, got %#v", got)
+	}
+	if hp.View.Defines != content.Defines {
+		t.Errorf("Expecting panic for the content view, got %s", SprintViewInfo(hp.View))
+	}
+	if !errors.Is(got, errBad) {
+		t.Errorf("Expecting error to wrap the panic value, got %s", got)
+	}
+}
+
+func TestTemplateHandler_HandlerPanicAfterWrite(t *testing.T) {
+	base := NewView(`<div>{{ . }}</div>`, func(rsp Response, req *http.Request) interface{} {
+		rsp.WriteHeader(http.StatusTeapot)
+		panic("after write")
+	})
+	exec := StringExecutor{}
+	handler := exec.NewViewHandler(base)
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("Expecting connection to be aborted, got %v", r)
+		}
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("Expecting status written by the handler, got %d", rec.Code)
+		}
+	}()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	t.Error("Expecting handler to panic")
+}
+
+func TestDeveloperExecutor_HandlerPanic(t *testing.T) {
+	base, _ := setupPanicHandler("something bad")
+	dev := DeveloperExecutor{&StringExecutor{}}
+	handler := dev.NewViewHandler(base)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+	got := sDumpBody(rec)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if !strings.Contains(got, `panic in handler for SubView(&#34;content&#34;`) {
+		t.Errorf("Expecting debug page to describe the view, got %s", got)
+	}
+	if !strings.Contains(got, "<h3>Stack:</h3>") || !strings.Contains(got, "setupPanicHandler") {
+		t.Errorf("Expecting debug page to include the stack, got %s", got)
+	}
+}
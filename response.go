@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"sync/atomic"
+	"time"
 )
 
 var (
@@ -63,6 +64,10 @@ type Response interface {
 	//
 	// NOTE: Since a sub handler may have returned nil, there is no way for the parent handler to determine
 	//       whether the name resolved to a concrete view.
+	//
+	// NOTE: For a sub view with a cache policy the value returned is a placeholder for the rendered
+	//       fragment, it should be passed to the template unchanged, see CachePolicy. The same
+	//       applies to a sub view with Stream enabled, see TemplateHandler.StreamPage.
 	HandleSubView(string, *http.Request) interface{}
 
 	// ResponseID returns the ID treetop has associated with this request.
@@ -83,6 +88,7 @@ type Response interface {
 type ResponseWrapper struct {
 	http.ResponseWriter
 	responseID       uint32
+	began            time.Time
 	context          context.Context
 	status           int
 	subViews         map[string]*View
@@ -92,6 +98,16 @@ type ResponseWrapper struct {
 	cancel           context.CancelFunc
 	derivedFrom      *ResponseWrapper
 	hijacked         bool
+	observer         Observer
+	fragment         bool
+	fragments        *renderedFragments
+	failures         *viewFailures
+	stream           *pageStream
+
+	// state used when handling sub views concurrently
+	shared   *concurrentState
+	detached bool
+	pending  map[string]*pendingSubView
 }
 
 // BeginResponse initializes the context for a treetop request response
@@ -99,6 +115,7 @@ func BeginResponse(cxt context.Context, w http.ResponseWriter) *ResponseWrapper
 	rsp := ResponseWrapper{
 		ResponseWriter: w,
 		responseID:     nextResponseID(),
+		began:          time.Now(),
 	}
 	rsp.context, rsp.cancel = context.WithCancel(cxt)
 	return &rsp
@@ -110,11 +127,18 @@ func (rsp *ResponseWrapper) WithSubViews(subViews map[string]*View) *ResponseWra
 	derived := ResponseWrapper{
 		ResponseWriter: rsp.ResponseWriter,
 		responseID:     rsp.responseID,
+		began:          rsp.began,
 		subViews:       make(map[string]*View),
 		context:        rsp.context,
 		cancel:         rsp.cancel,
 		derivedFrom:    rsp,
 		hijacked:       rsp.hijacked,
+		observer:       rsp.observer,
+		fragment:       rsp.fragment,
+		fragments:      rsp.fragments,
+		failures:       rsp.failures,
+		stream:         rsp.stream,
+		shared:         rsp.shared,
 	}
 	for k, v := range subViews {
 		derived.subViews[k] = v
@@ -166,24 +190,28 @@ func (rsp *ResponseWrapper) markHijacked() {
 // Write delegates to the underlying ResponseWriter while aborting the
 // treetop executor handler.
 func (rsp *ResponseWrapper) Write(b []byte) (int, error) {
-	if rsp.hijacked {
+	if rsp.hijacked || !rsp.shared.claim(rsp) {
 		return 0, ErrResponseHijacked
 	}
 	rsp.Cancel()
-	// prevent parent handler attempting to hijack the response
-	rsp.derivedFrom.markHijacked()
+	if rsp.shared == nil {
+		// prevent parent handler attempting to hijack the response
+		rsp.derivedFrom.markHijacked()
+	}
 	return rsp.ResponseWriter.Write(b)
 }
 
 // WriteHeader delegates to the underlying ResponseWriter while setting finished flag to true
 func (rsp *ResponseWrapper) WriteHeader(statusCode int) {
-	if rsp.Finished() {
+	if rsp.Finished() || rsp.hijacked || !rsp.shared.claim(rsp) {
 		// ignore erroneous calls to WriteHeader if the response is finished
 		return
 	}
 	rsp.Cancel()
-	// prevent parent handler attempting to hijack the response
-	rsp.derivedFrom.markHijacked()
+	if rsp.shared == nil {
+		// prevent parent handler attempting to hijack the response
+		rsp.derivedFrom.markHijacked()
+	}
 	rsp.ResponseWriter.WriteHeader(statusCode)
 }
 
@@ -197,8 +225,11 @@ func (rsp *ResponseWrapper) Status(status int) int {
 	if status > rsp.status {
 		rsp.status = status
 	}
-	// propegate status to root handler
-	rsp.derivedFrom.Status(status)
+	// propegate status to root handler, the status of a detached
+	// response is adopted by the parent when the data is received
+	if !rsp.detached {
+		rsp.derivedFrom.Status(status)
+	}
 	return rsp.status
 }
 
@@ -213,7 +244,9 @@ func (rsp *ResponseWrapper) ReplacePageURL(url string) {
 	rsp.pageURLSpecified = true
 
 	// propegate url to root handler
-	rsp.derivedFrom.ReplacePageURL(url)
+	if !rsp.detached {
+		rsp.derivedFrom.ReplacePageURL(url)
+	}
 }
 
 // DesignatePageURL will result in a header being added to the response
@@ -227,7 +260,9 @@ func (rsp *ResponseWrapper) DesignatePageURL(url string) {
 	rsp.pageURLSpecified = true
 
 	// propegate url to root handler
-	rsp.derivedFrom.DesignatePageURL(url)
+	if !rsp.detached {
+		rsp.derivedFrom.DesignatePageURL(url)
+	}
 }
 
 // Finished will return true if the response headers have been written to the
@@ -257,10 +292,22 @@ func (rsp *ResponseWrapper) HandleSubView(name string, req *http.Request) interf
 		return nil
 	}
 
+	if rsp.stream != nil && isStreamed(sub) {
+		// the block of the view will be rendered once the handler completes
+		if sv := rsp.startStream(name, req); sv != nil {
+			return sv
+		}
+	}
+
+	if p, ok := rsp.pending[name]; ok && !p.received {
+		// handler was started concurrently, wait for the data
+		return rsp.receive(p)
+	}
+
 	subResp := rsp.WithSubViews(sub.SubViews)
 
 	// Invoke sub handler, collecting the response
-	return sub.HandlerFunc(subResp, req)
+	return subResp.execute(sub, req)
 }
 
 // Context is getter for the treetop response context which will indicate when the request
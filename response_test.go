@@ -402,3 +402,152 @@ func TestResponseWriter_HandleSubView_ReplacePageURL(t *testing.T) {
 		t.Error("Expecting replace url flag to be true")
 	}
 }
+
+// concurrentResponse creates a response wrapper which handles sub views concurrently
+func concurrentResponse(w http.ResponseWriter, subViews map[string]*View) *ResponseWrapper {
+	rsp := BeginResponse(context.Background(), w)
+	rsp.shared = &concurrentState{}
+	return rsp.WithSubViews(subViews)
+}
+
+func TestResponseWrapper_ConcurrentSubViews(t *testing.T) {
+	rec := httptest.NewRecorder()
+	startedA := make(chan struct{})
+	startedB := make(chan struct{})
+	// each handler will block until the sibling has started
+	rsp := concurrentResponse(rec, map[string]*View{
+		"a": NewSubView("a", "a.html", func(rsp Response, _ *http.Request) interface{} {
+			close(startedA)
+			select {
+			case <-startedB:
+			case <-time.After(time.Second):
+				return "timeout"
+			}
+			rsp.Status(http.StatusBadRequest)
+			rsp.Header().Add("Vary", "Cookie")
+			return "A!!"
+		}),
+		"b": NewSubView("b", "b.html", func(rsp Response, _ *http.Request) interface{} {
+			close(startedB)
+			select {
+			case <-startedA:
+			case <-time.After(time.Second):
+				return "timeout"
+			}
+			rsp.Status(http.StatusTeapot)
+			rsp.DesignatePageURL("/some/path")
+			return "B!!"
+		}),
+	})
+
+	data := rsp.execute(NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		PrefetchSubViews(rsp, req, "a", "b")
+		return []interface{}{
+			rsp.HandleSubView("a", req),
+			rsp.HandleSubView("b", req),
+		}
+	}), nil)
+
+	if got := fmt.Sprint(data); got != "[A!! B!!]" {
+		t.Errorf("Expecting sub view data [A!! B!!], got %s", got)
+	}
+	if status := rsp.Status(0); status != http.StatusTeapot {
+		t.Errorf("Expecting the greatest status %d to be adopted, got %d", http.StatusTeapot, status)
+	}
+	if rsp.pageURL != "/some/path" {
+		t.Errorf("Expecting page URL to be designated as '/some/path', got %s", rsp.pageURL)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Cookie" {
+		t.Errorf("Expecting sub view header to be merged into the response, got Vary %#v", vary)
+	}
+}
+
+func TestResponseWrapper_ConcurrentSubViews_Hijacking(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rsp := concurrentResponse(rec, map[string]*View{
+		"a": NewSubView("a", "a.html", func(rsp Response, _ *http.Request) interface{} {
+			rsp.Header().Set("X-Testing", "a")
+			rsp.WriteHeader(http.StatusTeapot)
+			rsp.Write([]byte("a!!"))
+			return "A!!"
+		}),
+	})
+
+	var parentErr interface{}
+	data := rsp.execute(NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		PrefetchSubViews(rsp, req, "a")
+		// wait for the sub view to hijack the response
+		<-rsp.Context().Done()
+		_, parentErr = rsp.Write([]byte("parent!!"))
+		return rsp.HandleSubView("a", req)
+	}), nil)
+
+	if data != nil {
+		t.Errorf("Expecting no data from a finished response, got %#v", data)
+	}
+	if parentErr != ErrResponseHijacked {
+		t.Errorf("Expecting parent write to fail with hijacked error, got %#v", parentErr)
+	}
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("Expecting status %d, got %d", http.StatusTeapot, rec.Code)
+	}
+	if hdr := rec.Header().Get("X-Testing"); hdr != "a" {
+		t.Errorf("Expecting X-Testing header 'a', got %#v", hdr)
+	}
+	if bdy := rec.Body.String(); bdy != "a!!" {
+		t.Errorf("Expecting the sub view to hijack the response and write 'a!!', got %#v", bdy)
+	}
+}
+
+func TestResponseWrapper_ConcurrentSubViews_NotReceived(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rsp := concurrentResponse(rec, map[string]*View{
+		"a": NewSubView("a", "a.html", func(rsp Response, _ *http.Request) interface{} {
+			rsp.Status(http.StatusInternalServerError)
+			rsp.Header().Set("X-Testing", "a")
+			return "A!!"
+		}),
+	})
+
+	data := rsp.execute(NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		PrefetchSubViews(rsp, req)
+		return "parent!!"
+	}), nil)
+	if data != "parent!!" {
+		t.Errorf("Expecting parent data, got %#v", data)
+	}
+	if status := rsp.Status(0); status != 0 {
+		t.Errorf("Expecting status of sub view that was not received to be discarded, got %d", status)
+	}
+	if hdr := rec.Header().Get("X-Testing"); hdr != "" {
+		t.Errorf("Expecting header of sub view that was not received to be discarded, got %#v", hdr)
+	}
+	if len(rsp.pending) != 0 {
+		t.Errorf("Expecting pending sub views to be cleared, got %d", len(rsp.pending))
+	}
+}
+
+func TestResponseWrapper_ConcurrentSubViews_NotPrefetched(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var calledA, calledB bool
+	rsp := concurrentResponse(rec, map[string]*View{
+		"a": NewSubView("a", "a.html", func(rsp Response, _ *http.Request) interface{} {
+			calledA = true
+			return "A!!"
+		}),
+		"b": NewSubView("b", "b.html", func(rsp Response, _ *http.Request) interface{} {
+			calledB = true
+			return "B!!"
+		}),
+	})
+
+	data := rsp.execute(NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return rsp.HandleSubView("a", req)
+	}), nil)
+	if data != "A!!" || !calledA {
+		t.Errorf("Expecting sub view a to be executed on request, got %#v", data)
+	}
+	if calledB {
+		t.Error("Expecting sub view b not to be executed when it is neither prefetched nor requested")
+	}
+}
@@ -0,0 +1,454 @@
+package treetop
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template/parse"
+)
+
+// URLFuncName is the name of the template function used to build the URL of a named route,
+// see Router.FuncMap
+const URLFuncName = "urlFor"
+
+// Named sets the name of the route so that URLs can be built for it using Router.URL,
+// URLFor or the urlFor template function. The route is returned.
+//
+// Example:
+//
+//	router.HandleView("GET /users/{id}", userDetail).Named("user-detail")
+func (rt *Route) Named(name string) *Route {
+	rt.Name = name
+	return rt
+}
+
+// URL builds the path of a named route. Parameters are substituted for the wildcards
+// of the route pattern in order, a {name...} wildcard may contain slashes.
+//
+// Example:
+//
+//	router.HandleView("GET /users/{id}/posts/{post}", postDetail).Named("post-detail")
+//	router.URL("post-detail", 123, "hello world") // "/users/123/posts/hello%20world"
+func (r *Router) URL(name string, params ...interface{}) (string, error) {
+	route := r.namedRoute(name)
+	if route == nil {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+	u, err := buildRouteURL(route.Pattern, params)
+	if err != nil {
+		return "", fmt.Errorf("route %q: %w", name, err)
+	}
+	return u, nil
+}
+
+// FuncMap returns the template functions of the router, this is the urlFor function
+// which builds the path of a named route, see Router.URL.
+//
+// The functions are merged with the Funcs of built-in executors by NewRouter. Other executors
+// must include them in the functions used to parse templates before view handlers are registered.
+//
+// Example:
+//
+//	funcs := template.FuncMap{"upper": strings.ToUpper}
+//	exec := newCustomExecutor(funcs)
+//	router := treetop.NewRouter(exec)
+//	for name, fn := range router.FuncMap() {
+//		funcs[name] = fn
+//	}
+//
+// then in a template
+//
+//	<a href="{{ urlFor "user-detail" .ID }}">{{ .Name }}</a>
+func (r *Router) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		URLFuncName: r.URL,
+	}
+}
+
+// URLFor builds the path of a named route using the router serving the request, so that
+// handlers do not need to hard-code the path of another route. See Router.URL.
+//
+// Example:
+//
+//	href, err := treetop.URLFor(req, "user-detail", user.ID)
+//	if err != nil {
+//		...
+//	}
+//	treetop.Redirect(w, req, href, http.StatusSeeOther)
+func URLFor(req *http.Request, name string, params ...interface{}) (string, error) {
+	r, ok := req.Context().Value(routerContextKey{}).(*Router)
+	if !ok {
+		return "", fmt.Errorf("no router is serving the request, cannot build URL for route %q", name)
+	}
+	return r.URL(name, params...)
+}
+
+// routerContextKey is used to store the router in the context of a request
+type routerContextKey struct{}
+
+// withRouter adds the router to the context of the request
+func (r *Router) withRouter(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routerContextKey{}, r))
+}
+
+// namedRoute finds the first route registered with a name
+func (r *Router) namedRoute(name string) *Route {
+	for _, route := range r.routes {
+		if route.Name == name {
+			return route
+		}
+	}
+	return nil
+}
+
+// buildRouteURL substitutes parameters for the wildcards in the path of a ServeMux pattern
+func buildRouteURL(pattern string, params []interface{}) (string, error) {
+	var (
+		sb   strings.Builder
+		next int
+	)
+	for _, seg := range splitPattern(pattern) {
+		if seg.wildcard == "" {
+			sb.WriteString(seg.text)
+			continue
+		}
+		if next >= len(params) {
+			return "", fmt.Errorf("missing parameter for wildcard {%s}", seg.text)
+		}
+		value := fmt.Sprint(params[next])
+		next++
+		if !seg.rest && value == "" {
+			return "", fmt.Errorf("empty parameter for wildcard {%s}", seg.text)
+		}
+		if !seg.rest {
+			sb.WriteString(url.PathEscape(value))
+			continue
+		}
+		parts := strings.Split(value, "/")
+		for i := range parts {
+			parts[i] = url.PathEscape(parts[i])
+		}
+		sb.WriteString(strings.Join(parts, "/"))
+	}
+	if next < len(params) {
+		return "", fmt.Errorf("too many parameters, pattern %q has %d wildcards", pattern, next)
+	}
+	return sb.String(), nil
+}
+
+// patternSegment is literal path text or a wildcard of a ServeMux pattern
+type patternSegment struct {
+	text     string
+	wildcard string
+	rest     bool
+}
+
+// splitPattern divides the path of a ServeMux pattern into literal text and wildcards,
+// the method and host are removed. The {$} wildcard matches the end of the path, it is omitted.
+func splitPattern(pattern string) []patternSegment {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	var segs []patternSegment
+	for pattern != "" {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if start < 0 || end < start {
+			segs = append(segs, patternSegment{text: pattern})
+			break
+		}
+		if start > 0 {
+			segs = append(segs, patternSegment{text: pattern[:start]})
+		}
+		name := pattern[start+1 : end]
+		pattern = pattern[end+1:]
+		if name == "$" {
+			continue
+		}
+		seg := patternSegment{text: name, wildcard: name}
+		if trimmed, ok := strings.CutSuffix(name, "..."); ok {
+			seg.wildcard = trimmed
+			seg.rest = true
+		}
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+// patternWildcards returns the names of the wildcards of a ServeMux pattern, in order
+func patternWildcards(pattern string) []string {
+	var names []string
+	for _, seg := range splitPattern(pattern) {
+		if seg.wildcard != "" {
+			names = append(names, seg.wildcard)
+		}
+	}
+	return names
+}
+
+// checkURLs verifies that route names are unique and that each urlFor call in the templates
+// of view routes references a named route with the correct number of parameters.
+// Calls where the route name is not a string constant are not checked. A problem in a template
+// shared by several routes, such as a layout, is reported for the first route only.
+func (r *Router) checkURLs() RouteErrors {
+	var errs RouteErrors
+	names := make(map[string]*Route)
+	for _, route := range r.routes {
+		if route.Name == "" {
+			continue
+		}
+		if other, ok := names[route.Name]; ok {
+			errs = append(errs, &RouteError{
+				Pattern: route.Pattern,
+				Err:     fmt.Errorf("route name %q is already used by route %q", route.Name, other.Pattern),
+			})
+			continue
+		}
+		names[route.Name] = route
+	}
+	reported := make(map[string]bool)
+	for _, route := range r.routes {
+		th, ok := route.Handler.(templatesHandler)
+		if !ok {
+			continue
+		}
+		uc := &urlChecker{
+			names:     names,
+			templates: viewTemplatePaths(append([]*View{route.Page, route.Partial}, route.Includes...)...),
+			reported:  reported,
+		}
+		for _, t := range th.viewTemplates() {
+			for _, def := range t.Templates() {
+				if def.Tree != nil {
+					uc.walk(def.Tree, def.Tree.Root)
+				}
+			}
+		}
+		for _, problem := range uc.problems {
+			errs = append(errs, &RouteError{Pattern: route.Pattern, Err: problem})
+		}
+	}
+	return errs
+}
+
+// urlChecker walks template parse trees looking for urlFor calls
+type urlChecker struct {
+	names     map[string]*Route
+	templates map[string]string
+	reported  map[string]bool
+	problems  []error
+}
+
+// walk checks the nodes of a template list
+func (uc *urlChecker) walk(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			uc.pipe(tree, n.Pipe)
+		case *parse.IfNode:
+			uc.pipe(tree, n.Pipe)
+			uc.walk(tree, n.List)
+			uc.walk(tree, n.ElseList)
+		case *parse.WithNode:
+			uc.pipe(tree, n.Pipe)
+			uc.walk(tree, n.List)
+			uc.walk(tree, n.ElseList)
+		case *parse.RangeNode:
+			uc.pipe(tree, n.Pipe)
+			uc.walk(tree, n.List)
+			uc.walk(tree, n.ElseList)
+		case *parse.TemplateNode:
+			uc.pipe(tree, n.Pipe)
+		case *parse.ListNode:
+			uc.walk(tree, n)
+		}
+	}
+}
+
+// pipe checks the commands of a pipeline, a command after the first
+// receives the result of the previous command as its final argument
+func (uc *urlChecker) pipe(tree *parse.Tree, pipe *parse.PipeNode) {
+	if pipe == nil {
+		return
+	}
+	for i, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			if p, ok := arg.(*parse.PipeNode); ok {
+				uc.pipe(tree, p)
+			}
+		}
+		ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+		if !ok || ident.Ident != URLFuncName || len(cmd.Args) < 2 {
+			continue
+		}
+		name, ok := cmd.Args[1].(*parse.StringNode)
+		if !ok {
+			continue
+		}
+		count := len(cmd.Args) - 2
+		if i > 0 {
+			count++
+		}
+		uc.check(tree, cmd, name.Text, count)
+	}
+}
+
+// check that a route exists for the name with the same number of wildcards as parameters
+func (uc *urlChecker) check(tree *parse.Tree, node parse.Node, name string, count int) {
+	location, _ := tree.ErrorContext(node)
+	location = strings.TrimPrefix(location, tree.ParseName+":")
+	if path, ok := uc.templates[tree.ParseName]; ok {
+		location = fmt.Sprintf("template %s: line %s", path, location)
+	} else {
+		location = fmt.Sprintf("template %q: line %s", tree.ParseName, location)
+	}
+	// the same template can be parsed for many routes
+	if uc.reported[location] {
+		return
+	}
+	uc.reported[location] = true
+	route, ok := uc.names[name]
+	if !ok {
+		uc.problems = append(uc.problems, fmt.Errorf("%s: %s %q: no route named %q", location, URLFuncName, name, name))
+		return
+	}
+	if wildcards := patternWildcards(route.Pattern); len(wildcards) != count {
+		uc.problems = append(uc.problems, fmt.Errorf("%s: %s %q: expecting %d parameters for pattern %q, got %d",
+			location, URLFuncName, name, len(wildcards), route.Pattern, count))
+	}
+}
+
+// viewTemplatePaths maps the name defined by each view in the hierarchies to the view template
+func viewTemplatePaths(views ...*View) map[string]string {
+	paths := make(map[string]string)
+	queue := viewQueue{}
+	for _, v := range views {
+		if v != nil {
+			queue.add(v)
+		}
+	}
+	for !queue.empty() {
+		v, _ := queue.next()
+		if _, ok := paths[v.Defines]; !ok {
+			paths[v.Defines] = v.Template
+		}
+		for _, sub := range v.SubViews {
+			if sub != nil {
+				queue.add(sub)
+			}
+		}
+	}
+	return paths
+}
+
+// templatesHandler is implemented by view handlers that can list their parsed templates
+type templatesHandler interface {
+	viewTemplates() []*template.Template
+}
+
+// viewTemplates returns the page, partial and include templates of the handler
+func (h *TemplateHandler) viewTemplates() []*template.Template {
+	var out []*template.Template
+	for _, t := range append([]Template{h.PageTemplate, h.PartialTemplate}, h.IncludeTemplates...) {
+		if ht, ok := t.(*template.Template); ok && ht != nil {
+			out = append(out, ht)
+		}
+	}
+	return out
+}
+
+// viewTemplates returns the templates of the handler created when the development
+// handler was constructed
+func (h *devHandler) viewTemplates() []*template.Template {
+	if th, ok := h.initial.(templatesHandler); ok {
+		return th.viewTemplates()
+	}
+	return nil
+}
+
+// viewTemplates returns the templates of the current handler for the endpoint
+func (h *reloadHandler) viewTemplates() []*template.Template {
+	h.state.mu.RLock()
+	handler := h.state.handler
+	h.state.mu.RUnlock()
+	if th, ok := handler.(templatesHandler); ok {
+		return th.viewTemplates()
+	}
+	return nil
+}
+
+// funcsExecutor is implemented by executors which accept additional template functions,
+// see NewRouter
+type funcsExecutor interface {
+	addFuncs(template.FuncMap) error
+}
+
+// mergeFuncs creates a new function map with the functions of both maps, so that a map
+// shared with other executors is not modified. A name defined by both maps is an error.
+func mergeFuncs(funcs, extra template.FuncMap) (template.FuncMap, error) {
+	merged := make(template.FuncMap, len(funcs)+len(extra))
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+	for name, fn := range extra {
+		if _, ok := merged[name]; ok {
+			return funcs, fmt.Errorf("executor already has a template function named %q", name)
+		}
+		merged[name] = fn
+	}
+	return merged, nil
+}
+
+func (se *StringExecutor) addFuncs(funcs template.FuncMap) (err error) {
+	se.Funcs, err = mergeFuncs(se.Funcs, funcs)
+	return err
+}
+
+func (ks *KeyedStringExecutor) addFuncs(funcs template.FuncMap) (err error) {
+	ks.Funcs, err = mergeFuncs(ks.Funcs, funcs)
+	return err
+}
+
+func (fe *FileExecutor) addFuncs(funcs template.FuncMap) (err error) {
+	fe.Funcs, err = mergeFuncs(fe.Funcs, funcs)
+	return err
+}
+
+func (fse *FileSystemExecutor) addFuncs(funcs template.FuncMap) (err error) {
+	fse.Funcs, err = mergeFuncs(fse.Funcs, funcs)
+	return err
+}
+
+func (fse *FSExecutor) addFuncs(funcs template.FuncMap) (err error) {
+	fse.Funcs, err = mergeFuncs(fse.Funcs, funcs)
+	return err
+}
+
+func (de *DeveloperExecutor) addFuncs(funcs template.FuncMap) error {
+	return addExecutorFuncs(de.ViewExecutor, funcs)
+}
+
+func (re *ReloadExecutor) addFuncs(funcs template.FuncMap) error {
+	return addExecutorFuncs(re.ViewExecutor, funcs)
+}
+
+func (in *Inspector) addFuncs(funcs template.FuncMap) error {
+	return addExecutorFuncs(in.ViewExecutor, funcs)
+}
+
+// addExecutorFuncs passes template functions to an executor, if it accepts them
+func addExecutorFuncs(exec ViewExecutor, funcs template.FuncMap) error {
+	if fe, ok := exec.(funcsExecutor); ok {
+		return fe.addFuncs(funcs)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package treetop
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouter_URL(t *testing.T) {
+	router := NewRouter(&StringExecutor{})
+	router.Handle("GET /{$}", http.NotFoundHandler()).Named("home")
+	router.Handle("GET /users/{id}/posts/{post}", http.NotFoundHandler()).Named("post")
+	router.Handle("example.com/files/{path...}", http.NotFoundHandler()).Named("file")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		expect string
+		err    string
+	}{
+		{name: "home", expect: "/"},
+		{name: "post", params: []interface{}{123, "hello world"}, expect: "/users/123/posts/hello%20world"},
+		{name: "file", params: []interface{}{"a b/c.txt"}, expect: "/files/a%20b/c.txt"},
+		{name: "post", params: []interface{}{123}, err: `route "post": missing parameter for wildcard {post}`},
+		{name: "post", params: []interface{}{123, ""}, err: `route "post": empty parameter for wildcard {post}`},
+		{name: "home", params: []interface{}{1}, err: `route "home": too many parameters, pattern "GET /{$}" has 0 wildcards`},
+		{name: "missing", err: `no route named "missing"`},
+	}
+	for _, tt := range tests {
+		got, err := router.URL(tt.name, tt.params...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("URL(%q, %v): expecting error %q, got %v", tt.name, tt.params, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("URL(%q, %v): unexpected error %s", tt.name, tt.params, err)
+		} else if got != tt.expect {
+			t.Errorf("URL(%q, %v): expecting %q, got %q", tt.name, tt.params, tt.expect, got)
+		}
+	}
+}
+
+func TestRouter_URLFor(t *testing.T) {
+	exec := NewKeyedStringExecutor(map[string]string{
+		"base.html": `<main>{{ template "content" .Content }}</main>`,
+		"list.html": `<ul>{{ range . }}<li><a href="{{ urlFor "item" . }}">{{ . }}</a></li>{{ end }}</ul>`,
+		"item.html": `<p>item {{ . }}</p>`,
+	})
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	router := NewRouter(exec)
+	router.HandleView("GET /items", base.NewSubView("content", "list.html", Constant([]string{"a", "b c"}))).Named("items")
+	router.HandleView("GET /items/{id}", base.NewSubView("content", "item.html", func(rsp Response, req *http.Request) interface{} {
+		return req.PathValue("id")
+	})).Named("item")
+	router.Handle("POST /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		href, err := URLFor(req, "item", "new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		Redirect(w, req, href, http.StatusSeeOther)
+	}))
+	if err := router.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, mockRequest("/items", "text/html"))
+	expect := `<main><ul><li><a href="/items/a">a</a></li><li><a href="/items/b%20c">b c</a></li></ul></main>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+
+	req := mockRequest("/items", "text/html")
+	req.Method = "POST"
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/items/new" {
+		t.Errorf("Expecting redirect to /items/new, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if _, err := URLFor(mockRequest("/", "text/html"), "item", "new"); err == nil {
+		t.Error("Expecting an error without a router")
+	}
+}
+
+func TestRouter_Err_URLs(t *testing.T) {
+	keyed := NewKeyedStringExecutor(map[string]string{
+		"links.html": `<p>{{ urlFor "item" .ID }}{{ urlFor "missing" }}{{ .ID | urlFor "item" }}{{ with .Name }}{{ urlFor "items" . }}{{ end }}{{ urlFor .Name }}</p>`,
+	})
+	router := NewRouter(&DeveloperExecutor{keyed})
+	router.Handle("GET /items", http.NotFoundHandler()).Named("items")
+	router.Handle("GET /items/{id}", http.NotFoundHandler()).Named("item")
+	router.Handle("GET /other/{id}", http.NotFoundHandler()).Named("item")
+	router.HandleView("GET /links", NewView("links.html", Noop))
+
+	err := router.Err()
+	var routeErrs RouteErrors
+	if !errors.As(err, &routeErrs) {
+		t.Fatalf("Expecting RouteErrors, got %v", err)
+	}
+	expect := []string{
+		`route "GET /other/{id}": route name "item" is already used by route "GET /items/{id}"`,
+		`route "GET /links": template links.html: line 1:29: urlFor "missing": no route named "missing"`,
+		`route "GET /links": template links.html: line 1:92: urlFor "items": expecting 0 parameters for pattern "GET /items", got 1`,
+	}
+	got := make([]string, len(routeErrs))
+	for i, re := range routeErrs {
+		got[i] = re.Error()
+	}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("Expecting errors\n%s\nGOT\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRouter_Err_URLsSharedTemplate(t *testing.T) {
+	exec := NewKeyedStringExecutor(map[string]string{
+		"layout.html": `<nav><a href="{{ urlFor "home" }}">Home</a></nav>{{ template "content" .Content }}`,
+		"a.html":      `<p>A</p>`,
+		"b.html":      `<p>B {{ urlFor "missing" }}</p>`,
+	})
+	router := NewRouter(exec)
+	layout := NewView("layout.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	router.HandleView("GET /a", layout.NewSubView("content", "a.html", Noop))
+	router.HandleView("GET /b", layout.NewSubView("content", "b.html", Noop))
+
+	err := router.Err()
+	var routeErrs RouteErrors
+	if !errors.As(err, &routeErrs) {
+		t.Fatalf("Expecting RouteErrors, got %v", err)
+	}
+	expect := []string{
+		`route "GET /a": template layout.html: line 1:17: urlFor "home": no route named "home"`,
+		`route "GET /b": template b.html: line 1:8: urlFor "missing": no route named "missing"`,
+	}
+	got := make([]string, len(routeErrs))
+	for i, re := range routeErrs {
+		got[i] = re.Error()
+	}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("Expecting errors\n%s\nGOT\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestNewRouter_ExecutorFuncs(t *testing.T) {
+	shared := template.FuncMap{"upper": strings.ToUpper}
+	exec := &StringExecutor{Funcs: shared}
+	router := NewRouter(&DeveloperExecutor{exec})
+	if _, ok := exec.Funcs["upper"]; !ok {
+		t.Error("Expecting the existing executor funcs to be kept")
+	}
+	if _, ok := exec.Funcs[URLFuncName]; !ok {
+		t.Errorf("Expecting the %s func to be added to the executor", URLFuncName)
+	}
+	if _, ok := shared[URLFuncName]; ok {
+		t.Error("Expecting the original func map not to be modified")
+	}
+	if err := router.Err(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// a second router cannot replace the urlFor func of the first
+	funcs := exec.Funcs
+	other := NewRouter(exec)
+	if reflect.ValueOf(exec.Funcs).Pointer() != reflect.ValueOf(funcs).Pointer() {
+		t.Error("Expecting the executor funcs not to be modified by the second router")
+	}
+	expect := `router: executor already has a template function named "urlFor"`
+	if err := other.Err(); err == nil || strings.TrimSpace(err.Error()) != expect {
+		t.Errorf("Expecting error %s, got %v", expect, err)
+	}
+}
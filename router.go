@@ -0,0 +1,234 @@
+package treetop
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Router is a registry of the endpoints of a site. Views are bound to path patterns using
+// a http.ServeMux, handlers are created by the view executor.
+//
+// Patterns are those supported by http.ServeMux, they may include a method and wildcards.
+// A request with a method that does not match any pattern for the path will receive
+// a 405 Method Not Allowed response.
+//
+// Example:
+//
+//	router := treetop.NewRouter(&treetop.FileExecutor{})
+//	router.HandleView("GET /items", itemList)
+//	router.HandleView("GET /items/{id}", itemDetail)
+//	router.HandleFragment("POST /items/{id}/like", likeButton)
+//	if err := router.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":8080", router)
+type Router struct {
+	exec   ViewExecutor
+	mux    *http.ServeMux
+	routes []*Route
+	errs   RouteErrors
+}
+
+// Route is an endpoint registered with a Router
+type Route struct {
+	// Pattern is the http.ServeMux pattern for the route
+	Pattern string
+	// Name is used to build URLs for the route, see Named
+	Name string
+	// View and Includes are the views for a view route, nil otherwise
+	View     *View
+	Includes []*View
+	// Page and Partial are the compiled views used to handle full page
+	// and fragment requests, nil if the route does not accept the request
+	Page    *View
+	Partial *View
+	// Handler serves requests for the route
+	Handler http.Handler
+}
+
+// RouteError is a failure to register a route with a Router, the pattern is empty
+// for an error that does not concern a particular route
+type RouteError struct {
+	Pattern string
+	Err     error
+}
+
+// Error implements the error interface
+func (re *RouteError) Error() string {
+	if re.Pattern == "" {
+		// not specific to a route
+		return fmt.Sprintf("router: %s", re.Err)
+	}
+	return fmt.Sprintf("route %q: %s", re.Pattern, re.Err)
+}
+
+// Unwrap returns the underlying error
+func (re *RouteError) Unwrap() error {
+	return re.Err
+}
+
+// RouteErrors is a list of failures to register routes with a Router
+type RouteErrors []*RouteError
+
+// Error implements the error interface
+func (re RouteErrors) Error() string {
+	var output string
+	for i := range re {
+		output += re[i].Error() + "\n"
+	}
+	return output
+}
+
+// NewRouter creates a router which will use the executor to create view handlers.
+//
+// The template functions of the router are merged with the Funcs of built-in executors,
+// including those wrapped by a DeveloperExecutor, ReloadExecutor or Inspector. An executor
+// which already has a urlFor function, for example one shared with another router, is not
+// modified and the clash is reported by Router.Err. See Router.FuncMap.
+func NewRouter(exec ViewExecutor) *Router {
+	r := &Router{
+		exec: exec,
+		mux:  http.NewServeMux(),
+	}
+	if err := addExecutorFuncs(exec, r.FuncMap()); err != nil {
+		r.errs = append(r.errs, &RouteError{Err: err})
+	}
+	return r
+}
+
+// HandleView registers a view handler for the pattern that responds to page and fragment requests
+func (r *Router) HandleView(pattern string, view *View, includes ...*View) *Route {
+	page, part, _ := CompileViews(view, includes...)
+	return r.handleView(pattern, view, includes, page, part, nil)
+}
+
+// HandlePage registers a view handler for the pattern that only responds to page requests
+func (r *Router) HandlePage(pattern string, view *View, includes ...*View) *Route {
+	page, _, _ := CompileViews(view, includes...)
+	return r.handleView(pattern, view, includes, page, nil, ViewHandler.PageOnly)
+}
+
+// HandleFragment registers a view handler for the pattern that only responds to fragment requests
+func (r *Router) HandleFragment(pattern string, view *View, includes ...*View) *Route {
+	_, part, _ := CompileViews(view, includes...)
+	return r.handleView(pattern, view, includes, nil, part, ViewHandler.FragmentOnly)
+}
+
+// Handle registers a handler for the pattern which is not created from a view,
+// for example to serve static files
+func (r *Router) Handle(pattern string, handler http.Handler) *Route {
+	route := &Route{
+		Pattern: pattern,
+		Handler: handler,
+	}
+	r.register(route)
+	return route
+}
+
+// handleView creates a view handler using the executor and registers the route,
+// template errors are recorded against the route
+func (r *Router) handleView(pattern string, view *View, includes []*View, page, part *View, modify func(ViewHandler) ViewHandler) *Route {
+	handler := r.exec.NewViewHandler(view, includes...)
+	if errs := r.exec.FlushErrors(); len(errs) > 0 {
+		r.errs = append(r.errs, &RouteError{Pattern: pattern, Err: errs})
+	}
+	if modify != nil {
+		handler = modify(handler)
+	}
+	route := &Route{
+		Pattern:  pattern,
+		View:     view,
+		Includes: includes,
+		Page:     page,
+		Partial:  part,
+		Handler:  handler,
+	}
+	r.register(route)
+	return route
+}
+
+// register adds a route to the mux, a pattern which is not valid or which conflicts
+// with another route is recorded as an error
+func (r *Router) register(route *Route) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.errs = append(r.errs, &RouteError{Pattern: route.Pattern, Err: fmt.Errorf("%v", p)})
+		}
+	}()
+	r.mux.Handle(route.Pattern, route.Handler)
+	r.routes = append(r.routes, route)
+}
+
+// Err returns the errors that occurred while routes were registered, including template
+// errors of the view handlers. Nil is returned if all routes were registered successfully.
+//
+// Route names and the urlFor calls of view templates are also checked, so Err should be
+// called once all routes have been registered.
+func (r *Router) Err() error {
+	errs := append(RouteErrors(nil), r.errs...)
+	errs = append(errs, r.checkURLs()...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Routes returns the routes that have been registered, in order
+func (r *Router) Routes() []*Route {
+	routes := make([]*Route, len(r.routes))
+	copy(routes, r.routes)
+	return routes
+}
+
+// ServeHTTP implements http.Handler, the request is served by the handler of the matching route.
+// The router is added to the request context for use by URLFor.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, r.withRouter(req))
+}
+
+// SprintRoutes creates a string listing the patterns of all routes along with the compiled
+// view trees used to serve page and fragment requests.
+//
+// For example
+//
+//	GET /items/{id}
+//	  page:
+//	    - View("base.html", ...)
+//	      '- content: SubView("content", "item.html", ...)
+//	  fragment:
+//	    - SubView("content", "item.html", ...)
+func (r *Router) SprintRoutes() string {
+	var sb strings.Builder
+	for i, route := range r.routes {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(route.Pattern)
+		if route.View == nil {
+			fmt.Fprintf(&sb, "\n  handler: %T\n", route.Handler)
+			continue
+		}
+		if route.Page != nil {
+			sb.WriteString("\n  page:\n")
+			sb.WriteString(indentLines(SprintViewTree(route.Page), "    "))
+		}
+		if route.Partial != nil {
+			sb.WriteString("\n  fragment:\n")
+			sb.WriteString(indentLines(SprintViewTree(route.Partial), "    "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// indentLines adds a prefix to each non-empty line
+func indentLines(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,133 @@
+package treetop
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var routerTemplates = map[string]string{
+	"base.html":    `<main>{{ template "content" .Content }}</main>`,
+	"list.html":    `<ul>{{ range . }}<li>{{ . }}</li>{{ end }}</ul>`,
+	"item.html":    `<p>item {{ . }}</p>`,
+	"like.html":    `<button>liked {{ . }}</button>`,
+	"broken.html":  `<p>{{ .Broken </p>`,
+	"missing.html": `<main>no blocks</main>`,
+}
+
+func setupRouter() (*Router, *View) {
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	list := base.NewSubView("content", "list.html", Constant([]string{"a", "b"}))
+	item := base.NewSubView("content", "item.html", func(rsp Response, req *http.Request) interface{} {
+		return req.PathValue("id")
+	})
+	like := NewSubView("like", "like.html", func(rsp Response, req *http.Request) interface{} {
+		return req.PathValue("id")
+	})
+
+	router := NewRouter(NewKeyedStringExecutor(routerTemplates))
+	router.HandleView("GET /items", list)
+	router.HandlePage("GET /items/{id}", item)
+	router.HandleFragment("POST /items/{id}/like", like)
+	router.Handle("GET /static/", http.NotFoundHandler())
+	return router, base
+}
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	router, _ := setupRouter()
+	if err := router.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		accept string
+		status int
+		body   string
+	}{
+		{"GET", "/items", "text/html", 200, `<main><ul><li>a</li><li>b</li></ul></main>`},
+		{"GET", "/items", TemplateContentType, 200, "<template>\n<ul><li>a</li><li>b</li></ul>\n</template>"},
+		{"GET", "/items/123", "text/html", 200, `<main><p>item 123</p></main>`},
+		{"GET", "/items/123", TemplateContentType, 406, "Not Acceptable"},
+		{"POST", "/items/123/like", TemplateContentType, 200, "<template>\n<button>liked 123</button>\n</template>"},
+		{"GET", "/items/123/like", TemplateContentType, 405, "Method Not Allowed"},
+		{"GET", "/static/file.css", "text/html", 404, "404 page not found"},
+	}
+	for _, tt := range tests {
+		req := mockRequest(tt.path, tt.accept)
+		req.Method = tt.method
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expecting status %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+		if got := strings.TrimSpace(sDumpBody(rec)); got != tt.body {
+			t.Errorf("%s %s: expecting body %q, got %q", tt.method, tt.path, tt.body, got)
+		}
+	}
+}
+
+func TestRouter_Err(t *testing.T) {
+	router, base := setupRouter()
+	router.HandleView("GET /broken", base.NewSubView("content", "broken.html", Noop))
+	router.HandleView("GET /missing", NewView("missing.html", Noop).NewSubView("content", "item.html", Noop))
+	router.HandleView("GET /items", base.NewSubView("content", "item.html", Noop))
+	router.Handle("BAD PATTERN", http.NotFoundHandler())
+
+	err := router.Err()
+	var routeErrs RouteErrors
+	if !errors.As(err, &routeErrs) {
+		t.Fatalf("Expecting RouteErrors, got %v", err)
+	}
+	patterns := make([]string, len(routeErrs))
+	for i, re := range routeErrs {
+		patterns[i] = re.Pattern
+	}
+	expect := []string{"GET /broken", "GET /missing", "GET /items", "BAD PATTERN"}
+	if strings.Join(patterns, ", ") != strings.Join(expect, ", ") {
+		t.Errorf("Expecting errors for %v, got %v", expect, patterns)
+	}
+	var execErrs ExecutorErrors
+	if !errors.As(routeErrs[0], &execErrs) || execErrs[0].View.Template != "broken.html" {
+		t.Errorf("Expecting executor errors for the broken template, got %v", routeErrs[0])
+	}
+	if len(router.Routes()) != 6 {
+		t.Errorf("Expecting 6 routes, got %d", len(router.Routes()))
+	}
+}
+
+func TestRouter_SprintRoutes(t *testing.T) {
+	router, _ := setupRouter()
+	got := stripIndent(router.SprintRoutes())
+	expect := stripIndent(`
+		GET /items
+		  page:
+		    - View("base.html", github.com/rur/treetop.setupRouter.func1)
+		      '- content: SubView("content", "list.html", github.com/rur/treetop.Constant.func1)
+
+		  fragment:
+		    - SubView("content", "list.html", github.com/rur/treetop.Constant.func1)
+
+		GET /items/{id}
+		  page:
+		    - View("base.html", github.com/rur/treetop.setupRouter.func1)
+		      '- content: SubView("content", "item.html", github.com/rur/treetop.setupRouter.func2)
+
+		POST /items/{id}/like
+		  fragment:
+		    - SubView("like", "like.html", github.com/rur/treetop.setupRouter.func3)
+
+		GET /static/
+		  handler: http.HandlerFunc
+		`)
+	if got != expect {
+		t.Errorf("Expecting routes\n%s\nGOT\n%s", expect, got)
+	}
+}
@@ -0,0 +1,173 @@
+package treetop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// StaticPageFile is the file name used for the HTML document of an exported page
+	StaticPageFile = "index.html"
+	// StaticFragmentFile is the file name used for the template fragment of an exported page,
+	// the content type is TemplateContentType
+	StaticFragmentFile = "index.treetop.xml"
+)
+
+// StaticPage is a request path and the view used to render it, see StaticExporter
+type StaticPage struct {
+	Path     string
+	View     *View
+	Includes []*View
+}
+
+// StaticExporter pre-renders views to files so that pages can be served without running
+// handlers. Each page is rendered by a view handler from the executor using a synthetic GET
+// request for the path. A HTML document is written to Dir/<path>/index.html and the template
+// fragment response is written to Dir/<path>/index.treetop.xml.
+//
+// The exported files can be served with the correct content type for both kinds of request
+// using NewStaticHandler.
+//
+// Example:
+//
+//	exporter := treetop.StaticExporter{Exec: &treetop.FileExecutor{}, Dir: "public"}
+//	err := exporter.Export(ctx,
+//		treetop.StaticPage{Path: "/", View: home},
+//		treetop.StaticPage{Path: "/about", View: about},
+//	)
+type StaticExporter struct {
+	Exec ViewExecutor
+	Dir  string
+}
+
+// Export renders each page and writes the files to the export directory. An error is returned
+// if a template cannot be loaded or a response does not have a 200 status.
+//
+// Template errors of handlers created elsewhere with the same executor are kept by the executor,
+// see exportHandler.
+func (se *StaticExporter) Export(ctx context.Context, pages ...StaticPage) error {
+	for _, page := range pages {
+		handler, err := se.exportHandler(page)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(se.Dir, filepath.FromSlash(path.Clean("/"+page.Path)))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("static page %s: %w", page.Path, err)
+		}
+		for _, file := range []struct {
+			name   string
+			accept string
+		}{
+			{StaticPageFile, "text/html"},
+			{StaticFragmentFile, TemplateContentType},
+		} {
+			body, err := renderStatic(ctx, handler, page.Path, file.accept)
+			if err != nil {
+				return fmt.Errorf("static page %s: %w", page.Path, err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, file.name), body, 0o644); err != nil {
+				return fmt.Errorf("static page %s: %w", page.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// errorsAdder is implemented by executors that can store template errors, see CaptureErrors
+type errorsAdder interface {
+	AddErrors(ExecutorErrors)
+}
+
+// exportHandler creates the view handler for a page. Only the template errors of this handler
+// are reported, errors that were pending are returned to the executor. If the executor cannot
+// store errors, pending errors are reported rather than being discarded.
+func (se *StaticExporter) exportHandler(page StaticPage) (ViewHandler, error) {
+	pending := se.Exec.FlushErrors()
+	ea, ok := se.Exec.(errorsAdder)
+	if len(pending) > 0 && !ok {
+		return nil, fmt.Errorf("static export: executor has template errors from other handlers: %w", pending)
+	}
+	handler := se.Exec.NewViewHandler(page.View, page.Includes...)
+	errs := se.Exec.FlushErrors()
+	if len(pending) > 0 {
+		ea.AddErrors(pending)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("static page %s: %w", page.Path, errs)
+	}
+	return handler, nil
+}
+
+// renderStatic serves a synthetic GET request using the handler and returns the response body
+func renderStatic(ctx context.Context, handler http.Handler, urlPath, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	rec := newSubViewRecorder()
+	handler.ServeHTTP(rec, req)
+	if status := rec.status; status != 0 && status != http.StatusOK {
+		return nil, fmt.Errorf("%s response has status %d", accept, status)
+	}
+	return rec.body.Bytes(), nil
+}
+
+// NewStaticHandler creates a handler for the files written by a StaticExporter. Template
+// requests are served the fragment file of the page with the template content type,
+// other requests are served the HTML document.
+//
+// Example:
+//
+//	mux.Handle("/", treetop.NewStaticHandler(os.DirFS("public")))
+func NewStaticHandler(fsys fs.FS) http.Handler {
+	return &staticHandler{fsys: fsys}
+}
+
+// staticHandler serves exported pages from a file system
+type staticHandler struct {
+	fsys fs.FS
+}
+
+// ServeHTTP implements http.Handler
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !methodAllowed([]string{http.MethodGet}, req.Method) {
+		serveMethodNotAllowed(w, []string{http.MethodGet})
+		return
+	}
+	dir := path.Clean("/" + req.URL.Path)[1:]
+	if dir == "" {
+		dir = "."
+	}
+	name, contentType := StaticPageFile, "text/html; charset=utf-8"
+	if IsTemplateRequest(req) {
+		name, contentType = StaticFragmentFile, TemplateContentType
+	}
+	body, err := fs.ReadFile(h.fsys, path.Join(dir, name))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	var modTime time.Time
+	if info, err := fs.Stat(h.fsys, path.Join(dir, name)); err == nil {
+		modTime = info.ModTime()
+	}
+	header := w.Header()
+	addVary(header, "Accept")
+	header.Set("Content-Type", contentType)
+	if name == StaticFragmentFile {
+		if _, err := fs.Stat(h.fsys, path.Join(dir, StaticPageFile)); err == nil {
+			// a page exists at this URL, see TemplateHandler.ServeHTTP
+			header.Set("X-Page-URL", hexEscapeNonASCII(req.URL.RequestURI()))
+		}
+	}
+	http.ServeContent(w, req, name, modTime, bytes.NewReader(body))
+}
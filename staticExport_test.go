@@ -0,0 +1,139 @@
+package treetop
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupStaticPages() (*KeyedStringExecutor, []StaticPage) {
+	exec := NewKeyedStringExecutor(map[string]string{
+		"base.html":  `<html><body>{{ template "content" .Content }}</body></html>`,
+		"home.html":  `<p>home {{ . }}</p>`,
+		"about.html": `<p>about {{ . }}</p>`,
+	})
+	base := NewView("base.html", func(rsp Response, req *http.Request) interface{} {
+		return map[string]interface{}{
+			"Content": rsp.HandleSubView("content", req),
+		}
+	})
+	return exec, []StaticPage{
+		{Path: "/", View: base.NewSubView("content", "home.html", func(rsp Response, req *http.Request) interface{} {
+			return req.URL.Path
+		})},
+		{Path: "/company/about", View: base.NewSubView("content", "about.html", Constant("us"))},
+	}
+}
+
+func TestStaticExporter_Export(t *testing.T) {
+	exec, pages := setupStaticPages()
+	dir := t.TempDir()
+	exporter := StaticExporter{Exec: exec, Dir: dir}
+	if err := exporter.Export(context.Background(), pages...); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"index.html":                      `<html><body><p>home /</p></body></html>`,
+		"index.treetop.xml":               "<template>\n<p>home /</p>\n</template>",
+		"company/about/index.html":        `<html><body><p>about us</p></body></html>`,
+		"company/about/index.treetop.xml": "<template>\n<p>about us</p>\n</template>",
+	}
+	for name, expect := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Expecting file %s, got error %s", name, err)
+		} else if string(got) != expect {
+			t.Errorf("Expecting %s to contain\n%s\nGOT\n%s", name, expect, got)
+		}
+	}
+}
+
+func TestStaticExporter_Errors(t *testing.T) {
+	exec, pages := setupStaticPages()
+	exec.Templates["about.html"] = `<p>{{ .Broken </p>`
+	exporter := StaticExporter{Exec: exec, Dir: t.TempDir()}
+	err := exporter.Export(context.Background(), pages...)
+	if err == nil || !strings.HasPrefix(err.Error(), "static page /company/about: ") {
+		t.Errorf("Expecting a template error for the about page, got %v", err)
+	}
+
+	failing := NewView("home.html", func(rsp Response, req *http.Request) interface{} {
+		rsp.Status(http.StatusNotFound)
+		return nil
+	})
+	err = exporter.Export(context.Background(), StaticPage{Path: "/missing", View: failing})
+	if err == nil || err.Error() != "static page /missing: text/html response has status 404" {
+		t.Errorf("Expecting a status error, got %v", err)
+	}
+}
+
+func TestStaticExporter_PendingErrors(t *testing.T) {
+	exec, pages := setupStaticPages()
+	exec.Templates["broken.html"] = `<p>{{ .Broken </p>`
+	exec.NewViewHandler(NewView("broken.html", Noop))
+
+	exporter := StaticExporter{Exec: exec, Dir: t.TempDir()}
+	if err := exporter.Export(context.Background(), pages...); err != nil {
+		t.Fatalf("Expecting no errors for the exported pages, got %v", err)
+	}
+	errs := exec.FlushErrors()
+	if len(errs) == 0 || !strings.Contains(errs.Error(), "broken.html") {
+		t.Errorf("Expecting the executor to keep the error of the broken handler, got %v", errs)
+	}
+
+	dev := &DeveloperExecutor{exec}
+	dev.NewViewHandler(NewView("broken.html", Noop))
+	exporter.Exec = dev
+	err := exporter.Export(context.Background(), pages...)
+	if err == nil || !strings.HasPrefix(err.Error(), "static export: executor has template errors from other handlers: ") {
+		t.Errorf("Expecting pending errors to be reported, got %v", err)
+	}
+}
+
+func TestNewStaticHandler(t *testing.T) {
+	exec, pages := setupStaticPages()
+	dir := t.TempDir()
+	exporter := StaticExporter{Exec: exec, Dir: dir}
+	if err := exporter.Export(context.Background(), pages...); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewStaticHandler(os.DirFS(dir))
+
+	tests := []struct {
+		method      string
+		path        string
+		accept      string
+		status      int
+		contentType string
+		pageURL     string
+		body        string
+	}{
+		{"GET", "/", "text/html", 200, "text/html; charset=utf-8", "", `<html><body><p>home /</p></body></html>`},
+		{"GET", "/company/about/", TemplateContentType, 200, TemplateContentType, "/company/about/", "<template>\n<p>about us</p>\n</template>"},
+		{"GET", "/company/../company/about", "text/html", 200, "text/html; charset=utf-8", "", `<html><body><p>about us</p></body></html>`},
+		{"GET", "/company", "text/html", 404, "text/plain; charset=utf-8", "", "404 page not found"},
+		{"POST", "/", "text/html", 405, "text/plain; charset=utf-8", "", "Method Not Allowed"},
+	}
+	for _, tt := range tests {
+		req := mockRequest(tt.path, tt.accept)
+		req.Method = tt.method
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expecting status %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s %s: expecting content type %q, got %q", tt.method, tt.path, tt.contentType, got)
+		}
+		if got := rec.Header().Get("X-Page-URL"); got != tt.pageURL {
+			t.Errorf("%s %s: expecting page URL %q, got %q", tt.method, tt.path, tt.pageURL, got)
+		}
+		if got := strings.TrimSpace(sDumpBody(rec)); got != tt.body {
+			t.Errorf("%s %s: expecting body %q, got %q", tt.method, tt.path, tt.body, got)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package treetop
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sync"
+	"text/template/parse"
+	"time"
+)
+
+// size of the buffer used to write streamed responses, output is flushed when full
+const streamBufferSize = 4096
+
+// name of the template function used to receive the data of a streamed view
+const streamFuncName = "treetopStream"
+
+// the original template of a streamed view is renamed with this suffix, the view template
+// is redefined to receive the data of the view before the original is executed
+const streamTemplateSuffix = ":stream"
+
+// errStreamSubViewWrite indicates that the handler of a streamed view attempted to take over
+// writing the response after the document was sent
+var errStreamSubViewWrite = errors.New("treetop stream: streamed view handler cannot write the response after the page was sent")
+
+// errStreamPrefixMismatch indicates that the page head sent before handlers were
+// executed does not match the start of the rendered document
+var errStreamPrefixMismatch = errors.New("treetop stream: rendered document does not begin with the page head")
+
+// staticPageHead extracts the leading static HTML of a page template, this can be written
+// to the client before any handler is executed.
+//
+// Text is included up to the first action in the template, but not beyond an HTML comment
+// or the opening of an element whose content html/template escapes differently.
+// The head will end at the last complete tag.
+func staticPageHead(tmpl Template, name string) []byte {
+	ht, ok := tmpl.(*template.Template)
+	if !ok || ht == nil {
+		return nil
+	}
+	t := ht.Lookup(name)
+	if t == nil || t.Tree == nil || t.Tree.Root == nil {
+		return nil
+	}
+	var text []byte
+	for _, node := range t.Tree.Root.Nodes {
+		tn, ok := node.(*parse.TextNode)
+		if !ok {
+			break
+		}
+		text = append(text, tn.Text...)
+	}
+	lower := bytes.ToLower(text)
+	cut := len(text)
+	for _, marker := range []string{"<!--", "<script", "<style", "<textarea", "<title"} {
+		if i := bytes.Index(lower, []byte(marker)); i > -1 && i < cut {
+			cut = i
+		}
+	}
+	end := bytes.LastIndexByte(text[:cut], '>')
+	if end < 0 {
+		return nil
+	}
+	head := make([]byte, end+1)
+	copy(head, text)
+	return head
+}
+
+// streamWriter writes a rendered page to the connection, flushing after each write.
+// Response headers are written with the first output.
+type streamWriter struct {
+	w       http.ResponseWriter
+	status  int
+	started bool
+	// skip is the part of the document which has already been sent
+	skip []byte
+	// number of bytes written to the connection
+	written int64
+}
+
+// begin will write response headers if they have not been sent already
+func (sw *streamWriter) begin() {
+	if sw.started {
+		return
+	}
+	sw.started = true
+	if sw.status > 0 {
+		sw.w.WriteHeader(sw.status)
+	}
+}
+
+// Write implements io.Writer
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(sw.skip) > 0 {
+		k := len(sw.skip)
+		if len(p) < k {
+			k = len(p)
+		}
+		if !bytes.Equal(sw.skip[:k], p[:k]) {
+			return 0, errStreamPrefixMismatch
+		}
+		sw.skip = sw.skip[k:]
+		p = p[k:]
+		if len(p) == 0 {
+			return n, nil
+		}
+	}
+	sw.begin()
+	m, err := sw.w.Write(p)
+	sw.written += int64(m)
+	if err != nil {
+		return 0, err
+	}
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, nil
+}
+
+// isStreamed returns true if the block of a view can be streamed, the root view
+// of a page cannot be streamed
+func isStreamed(v *View) bool {
+	return v != nil && v.Stream && v.Defines != ""
+}
+
+// streamedSubView is the data returned by HandleSubView for a view with Stream enabled, while
+// the handler executes concurrently. The data is received when the block of the view is rendered.
+type streamedSubView struct {
+	// rsp is the response of the parent handler
+	rsp      *ResponseWrapper
+	pending  *pendingSubView
+	stream   *pageStream
+	received bool
+	data     interface{}
+	err      error
+}
+
+// pageStream is shared by the response wrappers of a streamed page response
+type pageStream struct {
+	mu    sync.Mutex
+	views []*streamedSubView
+	// flush writes the document rendered so far to the connection, it is nil
+	// unless the template output is sent as it is executed
+	flush func() error
+}
+
+// startStream begins executing the handler of a streamed view, the parent handler will not
+// wait for it to complete. Nil is returned if the handler could not be started.
+func (rsp *ResponseWrapper) startStream(name string, req *http.Request) *streamedSubView {
+	p, ok := rsp.pending[name]
+	if !ok {
+		rsp.startSubViews(req, []string{name})
+		p, ok = rsp.pending[name]
+	}
+	if !ok || p.received {
+		return nil
+	}
+	delete(rsp.pending, name)
+	sv := &streamedSubView{
+		rsp:     rsp,
+		pending: p,
+		stream:  rsp.stream,
+	}
+	rsp.stream.mu.Lock()
+	defer rsp.stream.mu.Unlock()
+	rsp.stream.views = append(rsp.stream.views, sv)
+	return sv
+}
+
+// receive waits for the data of a streamed view. Before output has been sent, the status,
+// headers and page URL of the sub view response are adopted as usual. Otherwise the document
+// rendered so far is sent to the client while the handler completes, after which the sub view
+// response cannot be applied.
+func (ps *pageStream) receive(sv *streamedSubView) (interface{}, error) {
+	if sv.received {
+		return sv.data, sv.err
+	}
+	sv.received = true
+	if ps.flush == nil {
+		sv.data = sv.rsp.receive(sv.pending)
+		return sv.data, nil
+	}
+	if sv.err = ps.flush(); sv.err != nil {
+		return nil, sv.err
+	}
+	p := sv.pending
+	select {
+	case <-p.done:
+	case <-sv.rsp.context.Done():
+		sv.err = sv.rsp.context.Err()
+		return nil, sv.err
+	}
+	p.received = true
+	switch {
+	case p.panicked:
+		sv.err = panicError(p.recovered)
+	case p.rec.written:
+		sv.err = errStreamSubViewWrite
+	default:
+		sv.data = p.data
+	}
+	return sv.data, sv.err
+}
+
+// join waits for the handlers of all streamed views to complete. Before output has been sent,
+// the data of each view is received so that the sub view responses are applied. Otherwise the
+// errors of views that were not rendered are returned.
+func (ps *pageStream) join() []error {
+	if ps == nil {
+		return nil
+	}
+	ps.mu.Lock()
+	views := ps.views
+	ps.mu.Unlock()
+	var errs []error
+	for _, sv := range views {
+		if ps.flush == nil {
+			ps.receive(sv)
+			continue
+		}
+		if sv.received {
+			continue
+		}
+		<-sv.pending.done
+		if sv.pending.panicked {
+			errs = append(errs, panicError(sv.pending.recovered))
+		}
+	}
+	return errs
+}
+
+// panicError converts a value recovered from a sub view handler into an error
+func panicError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
+
+// bindStreamFunc adds the template function used to receive the data of streamed views
+func bindStreamFunc(t *template.Template) {
+	t.Funcs(template.FuncMap{
+		streamFuncName: func(data interface{}) (interface{}, error) {
+			if sv, ok := data.(*streamedSubView); ok {
+				return sv.stream.receive(sv)
+			}
+			return data, nil
+		},
+	})
+}
+
+// defineStream will redefine the template of a streamed view so that the data is received
+// before the original template is executed, the original template is renamed
+func defineStream(out *template.Template, v *View) error {
+	tmpl := out.Lookup(v.Defines)
+	if tmpl == nil || tmpl.Tree == nil {
+		return nil
+	}
+	if _, err := out.AddParseTree(v.Defines+streamTemplateSuffix, tmpl.Tree.Copy()); err != nil {
+		return err
+	}
+	_, err := out.Parse(fmt.Sprintf(
+		`{{ define %q }}{{ template %q (%s .) }}{{ end }}`,
+		v.Defines, v.Defines+streamTemplateSuffix, streamFuncName,
+	))
+	return err
+}
+
+// streamPageRequest will render a HTML document while writing to the connection as early
+// as possible. If the page template begins with static HTML, it is sent before handlers are
+// executed. Thereafter handlers can no longer affect the status or headers of the response.
+//
+// The template output is written to the connection as it is executed. When sub views are
+// handled concurrently, the handler of a view with Stream enabled runs while the document
+// is rendered. The output preceding the block of the view is sent, then the block is
+// rendered once the handler completes.
+//
+// When views of the page have an error template the document is rendered before it is sent,
+// so that error templates are substituted as usual. The handlers of streamed views must
+// complete before rendering begins in that case.
+//
+// When an error occurs after output has been sent to the client, the error is logged and
+// the connection is aborted so that the client can detect that the document is incomplete.
+func (h *TemplateHandler) streamPageRequest(resp *ResponseWrapper, req *http.Request) {
+	errlog := h.newResponseErrorLog(resp, req, h.Page)
+	if h.Page == nil {
+		errlog(ErrNotAcceptable)
+		return
+	}
+
+	sw := &streamWriter{w: resp.ResponseWriter}
+	if resp.shared != nil {
+		resp.stream = &pageStream{}
+	}
+	if len(h.pageHead) > 0 {
+		// commit to the response before handlers are executed,
+		// handlers can no longer take over writing the response
+		resp.hijacked = true
+		if !resp.shared.claim(resp) {
+			return
+		}
+		h.setPageHeaders(resp.ResponseWriter.Header())
+		setCacheControl(resp.ResponseWriter.Header(), h.pageCacheControl, 0)
+		sw.begin()
+		n, err := resp.ResponseWriter.Write(h.pageHead)
+		sw.written += int64(n)
+		if err != nil {
+			h.logResponse(slog.LevelError, "treetop: page write error", resp, req, h.Page, err)
+			return
+		}
+		if f, ok := resp.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		sw.skip = h.pageHead
+	}
+
+	data := resp.WithSubViews(h.Page.SubViews).execute(h.Page, req)
+	if resp.Finished() {
+		return
+	}
+	if h.pageErrors != nil {
+		// the handlers of streamed views must complete before the document is rendered
+		resp.stream.join()
+		if resp.Finished() {
+			return
+		}
+	}
+	if !sw.started && !resp.shared.claim(resp) {
+		return
+	}
+
+	began := time.Now()
+	var err error
+	if h.pageErrors != nil {
+		// the document is rendered before it is sent, so that the error template of a
+		// view can be substituted for a block that fails
+		buf := getBuffer()
+		defer releaseBuffer(buf)
+		err = h.executeTemplate(resp, req, buf, h.PageTemplate, h.pageErrors, h.Page, data)
+		if err == nil {
+			h.beginStream(resp, sw)
+			_, err = sw.Write(buf.Bytes())
+		}
+	} else {
+		// template output is written to the connection as it is executed
+		h.beginStream(resp, sw)
+		bw := bufio.NewWriterSize(sw, streamBufferSize)
+		if resp.stream != nil {
+			resp.stream.flush = bw.Flush
+		}
+		err = h.PageTemplate.ExecuteTemplate(bw, h.Page.Defines, data)
+		if err == nil {
+			err = bw.Flush()
+		}
+		resp.observeTemplate(req, h.Page, began, int(sw.written), err)
+		if err == nil {
+			resp.fragments.commit()
+		} else {
+			resp.fragments.discard()
+		}
+		// wait for the handlers of streamed views that were not rendered
+		for _, serr := range resp.stream.join() {
+			h.logResponse(slog.LevelError, "treetop: streamed view error", resp, req, h.Page, serr)
+		}
+	}
+	if err == nil {
+		return
+	}
+	if !sw.started {
+		// nothing has been sent, the error can be handled as normal
+		errlog(err)
+		return
+	}
+	h.logResponse(slog.LevelError, "treetop: page stream error", resp, req, h.Page, err)
+	panic(http.ErrAbortHandler)
+}
+
+// beginStream sets the page headers and status for a streamed response,
+// unless the page head has already been sent
+func (h *TemplateHandler) beginStream(resp *ResponseWrapper, sw *streamWriter) {
+	if sw.started {
+		return
+	}
+	h.setPageHeaders(resp.Header())
+	sw.status = resp.Status(0)
+	setCacheControl(resp.Header(), h.pageCacheControl, sw.status)
+}
+
+// setPageHeaders adds the content headers for a HTML document response
+func (h *TemplateHandler) setPageHeaders(header http.Header) {
+	if h.Partial != nil {
+		// inform cache that another content type is possible for this endpoint
+		addVary(header, "Accept")
+	}
+	// set content type as standard html mimetype
+	header.Set("Content-Type", "text/html")
+}
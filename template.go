@@ -10,11 +10,16 @@ import (
 	"text/template/parse"
 )
 
+// TemplateLoader is used by executors to create a html template for a view hierarchy.
+// An optional cache can be used to share parsed templates between handlers.
 type TemplateLoader struct {
 	Load  func(string) (string, error)
 	Funcs template.FuncMap
+	Cache *TemplateCache
 }
 
+// NewTemplateLoader creates a template loader with a function for loading template
+// strings from a view template path or key
 func NewTemplateLoader(funcs template.FuncMap, load func(string) (string, error)) *TemplateLoader {
 	return &TemplateLoader{
 		Load:  load,
@@ -22,11 +27,28 @@ func NewTemplateLoader(funcs template.FuncMap, load func(string) (string, error)
 	}
 }
 
+// ViewTemplate will load and parse the templates for a view hierarchy into a single
+// html template. A failure relating to a view in the hierarchy will be reported
+// as an *ExecutorError referencing the view.
 func (tl TemplateLoader) ViewTemplate(view *View) (*template.Template, error) {
+	out, _, err := tl.viewTemplate(view)
+	return out, err
+}
+
+// viewTemplate will load and parse the templates for a view hierarchy, the error boundaries
+// will be nil unless a view in the hierarchy has an error template
+func (tl TemplateLoader) viewTemplate(view *View) (*template.Template, *errorBoundaries, error) {
 	if view == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
-	var out *template.Template
+	var (
+		out      *template.Template
+		hasErrs  bool
+		cached   []*View
+		streamed []*View
+		owners   = make(map[string]*View)
+		parents  = make(map[*View]*View)
+	)
 
 	queue := viewQueue{}
 	queue.add(view)
@@ -37,28 +59,159 @@ func (tl TemplateLoader) ViewTemplate(view *View) (*template.Template, error) {
 		if out == nil {
 			out = template.New(v.Defines).Funcs(tl.Funcs)
 			t = out
-		} else {
+		} else if tl.Cache == nil {
 			t = out.New(v.Defines)
 		}
-		templateString, err := tl.Load(v.Template)
-		if err != nil {
-			return nil, fmt.Errorf(`failed to load template %#v: %s`, v.Template, err)
+		if err := tl.parseView(out, t, v); err != nil {
+			return nil, nil, err
 		}
-
-		if _, err := t.Parse(templateString); err != nil {
-			return nil, fmt.Errorf(`failed to parse template %#v: %s`, v.Template, err)
+		if v.ErrorTemplate != "" {
+			hasErrs = true
+			var et *template.Template
+			if tl.Cache == nil {
+				et = out.New(errorTemplateName(v))
+			}
+			if err := tl.parseTemplate(out, et, v, v.ErrorTemplate, errorTemplateName(v)); err != nil {
+				return nil, nil, err
+			}
+		}
+		// record the view responsible for each template that was defined
+		for _, t := range out.Templates() {
+			if _, ok := owners[t.Name()]; !ok {
+				owners[t.Name()] = v
+			}
+		}
+		// a sub view replaces the default block content of the parent
+		owners[v.Defines] = v
+		if isCached(v) && v.dataType != nil {
+			// the parent handler would receive the fragment placeholder rather than typed data
+			return nil, nil, &ExecutorError{
+				View: v,
+				Err:  fmt.Errorf("template %s: a view with data type %s cannot have a cache policy", v.Template, v.dataType),
+			}
+		}
+		if isStreamed(v) && v.dataType != nil {
+			// the parent handler would receive the stream placeholder rather than typed data
+			return nil, nil, &ExecutorError{
+				View: v,
+				Err:  fmt.Errorf("template %s: a view with data type %s cannot be streamed", v.Template, v.dataType),
+			}
 		}
+		if isStreamed(v) && v != view {
+			streamed = append(streamed, v)
+			owners[v.Defines+streamTemplateSuffix] = v
+		}
+		if isCached(v) {
+			cached = append(cached, v)
+			owners[v.Defines+fragmentTemplateSuffix] = v
+		}
+
 		// require template to declare a template/block node for each direct subview name
-		if err := checkTemplateForBlockNames(t, v.SubViews); err != nil {
-			return nil, fmt.Errorf("template %s: %s", v.Template, err)
+		if err := checkTemplateForBlockNames(out.Lookup(v.Defines), v.SubViews); err != nil {
+			return nil, nil, &ExecutorError{
+				View: v,
+				Err:  fmt.Errorf("template %s: %w", v.Template, err),
+			}
+		}
+		if err := checkTemplateData(out.Lookup(v.Defines), v); err != nil {
+			return nil, nil, &ExecutorError{
+				View: v,
+				Err:  fmt.Errorf("template %s: %w", v.Template, err),
+			}
 		}
 		for _, sub := range v.SubViews {
 			if sub != nil {
+				parents[sub] = v
 				queue.add(sub)
 			}
 		}
 	}
-	return out, nil
+	if len(cached) > 0 {
+		bindFragmentFunc(out)
+		for _, v := range cached {
+			if err := defineFragment(out, v); err != nil {
+				return nil, nil, &ExecutorError{View: v, Err: err}
+			}
+		}
+	}
+	if len(streamed) > 0 {
+		bindStreamFunc(out)
+		for _, v := range streamed {
+			if err := defineStream(out, v); err != nil {
+				return nil, nil, &ExecutorError{View: v, Err: err}
+			}
+		}
+	}
+	if !hasErrs {
+		return out, nil, nil
+	}
+	// a copy of the templates must be made before the output is executed
+	source, err := out.Clone()
+	if err != nil {
+		return nil, nil, &ExecutorError{View: view, Err: err}
+	}
+	return out, &errorBoundaries{
+		source:  source,
+		owners:  owners,
+		parents: parents,
+	}, nil
+}
+
+// parseView will load and parse the template for a view. When a cache is available the
+// parse trees are copied to the output template, otherwise the source is parsed using t
+func (tl TemplateLoader) parseView(out, t *template.Template, v *View) error {
+	return tl.parseTemplate(out, t, v, v.Template, v.Defines)
+}
+
+// parseTemplate will load and parse a template path on behalf of a view
+func (tl TemplateLoader) parseTemplate(out, t *template.Template, v *View, tmplPath, name string) error {
+	if tl.Cache != nil {
+		cached, ok := tl.Cache.get(tmplPath)
+		if !ok {
+			templateString, err := tl.Load(tmplPath)
+			if err != nil {
+				return &ExecutorError{
+					View: v,
+					Err:  fmt.Errorf(`failed to load template %#v: %w`, tmplPath, err),
+				}
+			}
+			trees, err := parseTemplateTrees(name, templateString, tl.Funcs)
+			if err != nil {
+				return &ExecutorError{
+					View: v,
+					Err:  fmt.Errorf(`failed to parse template %#v: %w`, tmplPath, err),
+				}
+			}
+			cached = &cachedTemplate{
+				name:   name,
+				source: templateString,
+				trees:  trees,
+			}
+			tl.Cache.put(tmplPath, cached)
+		}
+		if err := addCachedTemplate(out, cached, name); err != nil {
+			return &ExecutorError{
+				View: v,
+				Err:  fmt.Errorf(`failed to parse template %#v: %w`, tmplPath, err),
+			}
+		}
+		return nil
+	}
+
+	templateString, err := tl.Load(tmplPath)
+	if err != nil {
+		return &ExecutorError{
+			View: v,
+			Err:  fmt.Errorf(`failed to load template %#v: %w`, tmplPath, err),
+		}
+	}
+	if _, err := t.Parse(templateString); err != nil {
+		return &ExecutorError{
+			View: v,
+			Err:  fmt.Errorf(`failed to parse template %#v: %w`, tmplPath, err),
+		}
+	}
+	return nil
 }
 
 // utilities ---
@@ -95,8 +248,10 @@ func (q *viewQueue) empty() bool {
 // that match the declared block names. If a block naming is not present, return an error
 func checkTemplateForBlockNames(tmpl *template.Template, subviews map[string]*View) error {
 	parsedBlocks := make(map[string]bool)
-	for _, tplName := range listTemplateNodeName(tmpl.Tree.Root) {
-		parsedBlocks[tplName] = true
+	if tmpl != nil && tmpl.Tree != nil {
+		for _, tplName := range listTemplateNodeName(tmpl.Tree.Root) {
+			parsedBlocks[tplName] = true
+		}
 	}
 
 	var missing []string
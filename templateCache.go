@@ -0,0 +1,122 @@
+package treetop
+
+import (
+	"html/template"
+	"sync"
+	"text/template/parse"
+)
+
+// TemplateCache memoizes the source and parse trees of templates by path, so that a
+// template shared by many handlers will be loaded and parsed only once.
+// The parse trees are copied into the html template of each handler.
+//
+// A cache instance should only be used by one executor since the templates are
+// parsed with the FuncMap of the executor.
+//
+// Example:
+//
+//	exec := treetop.FileExecutor{Cache: treetop.NewTemplateCache()}
+type TemplateCache struct {
+	mu        sync.RWMutex
+	templates map[string]*cachedTemplate
+}
+
+// cachedTemplate is the loaded and parsed content of a template file
+type cachedTemplate struct {
+	name   string
+	source string
+	trees  map[string]*parse.Tree
+}
+
+// NewTemplateCache creates an empty template cache
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{
+		templates: make(map[string]*cachedTemplate),
+	}
+}
+
+// Invalidate will remove the templates with the supplied paths from the cache so
+// that they are loaded again next time they are needed. If no paths are
+// supplied, the cache will be cleared.
+func (tc *TemplateCache) Invalidate(paths ...string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if len(paths) == 0 {
+		tc.templates = make(map[string]*cachedTemplate)
+		return
+	}
+	for _, path := range paths {
+		delete(tc.templates, path)
+	}
+}
+
+// Source returns the cached source for a template path if it is available.
+func (tc *TemplateCache) Source(path string) (string, bool) {
+	cached, ok := tc.get(path)
+	if !ok {
+		return "", false
+	}
+	return cached.source, true
+}
+
+func (tc *TemplateCache) get(path string) (*cachedTemplate, bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	cached, ok := tc.templates[path]
+	return cached, ok
+}
+
+func (tc *TemplateCache) put(path string, cached *cachedTemplate) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.templates == nil {
+		tc.templates = make(map[string]*cachedTemplate)
+	}
+	tc.templates[path] = cached
+}
+
+// CachingExecutor is implemented by view executors that have a template cache.
+// The DeveloperExecutor will invalidate the cache before reloading templates.
+type CachingExecutor interface {
+	ViewExecutor
+	TemplateCache() *TemplateCache
+}
+
+// parseTemplateTrees will parse a template string into a map of parse trees
+// keyed by the template name
+func parseTemplateTrees(name, text string, funcs template.FuncMap) (map[string]*parse.Tree, error) {
+	t, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	trees := make(map[string]*parse.Tree)
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			trees[tmpl.Name()] = tmpl.Tree
+		}
+	}
+	return trees, nil
+}
+
+// addCachedTemplate copies the parse trees of a cached template into an html template,
+// the body of the template file will be named after the view block name
+func addCachedTemplate(out *template.Template, cached *cachedTemplate, defines string) error {
+	for name, tree := range cached.trees {
+		tree = tree.Copy()
+		tree.ParseName = defines
+		if name == cached.name {
+			name = defines
+			tree.Name = defines
+		}
+		if parse.IsEmptyTree(tree.Root) {
+			if existing := out.Lookup(name); existing != nil && existing.Tree != nil {
+				// do not replace an existing template with an empty template
+				continue
+			}
+		}
+		if _, err := out.AddParseTree(name, tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
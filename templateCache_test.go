@@ -0,0 +1,129 @@
+package treetop
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS records the number of times each file has been opened
+type countingFS struct {
+	fstest.MapFS
+	opened map[string]int
+}
+
+func (cfs *countingFS) Open(name string) (fs.File, error) {
+	cfs.opened[name]++
+	return cfs.MapFS.Open(name)
+}
+
+func (cfs *countingFS) ReadFile(name string) ([]byte, error) {
+	cfs.opened[name]++
+	return cfs.MapFS.ReadFile(name)
+}
+
+func newCountingFS(files map[string]string) *countingFS {
+	cfs := &countingFS{
+		MapFS:  make(fstest.MapFS),
+		opened: make(map[string]int),
+	}
+	for name, content := range files {
+		cfs.MapFS[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return cfs
+}
+
+func TestTemplateCache_SharedBetweenHandlers(t *testing.T) {
+	cfs := newCountingFS(map[string]string{
+		"base.html": `<div>{{ block "content" . }}default{{ end }}</div>`,
+		"a.html":    `<p>A {{ . }}</p>`,
+		"b.html":    `<p>B {{ . }}</p>`,
+	})
+	exec := &FSExecutor{FS: cfs, Cache: NewTemplateCache()}
+	base := NewView("base.html", Delegate("content"))
+	a := base.NewSubView("content", "a.html", Constant("a!!"))
+	b := base.NewSubView("content", "b.html", Constant("b!!"))
+
+	handlerA := exec.NewViewHandler(a)
+	handlerB := exec.NewViewHandler(b)
+	handlerBase := exec.NewViewHandler(base)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal("Unexpected executor errors\n", errs)
+	}
+
+	if len(cfs.opened) != 3 {
+		t.Errorf("Expecting 3 template files to be loaded, got %v", cfs.opened)
+	}
+	for path, count := range cfs.opened {
+		if count != 1 {
+			t.Errorf("Expecting %s to be loaded once, got %d", path, count)
+		}
+	}
+
+	for _, tt := range []struct {
+		handler ViewHandler
+		expect  string
+	}{
+		{handler: handlerA, expect: `<div><p>A a!!</p></div>`},
+		{handler: handlerB, expect: `<div><p>B b!!</p></div>`},
+		{handler: handlerBase, expect: `<div>default</div>`},
+	} {
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+		if got := sDumpBody(rec); got != tt.expect {
+			t.Errorf("Expecting page body %s, got %s", tt.expect, got)
+		}
+	}
+}
+
+func TestTemplateCache_Invalidate(t *testing.T) {
+	cfs := newCountingFS(map[string]string{
+		"a.html": `<p>Before {{ . }}</p>`,
+		"b.html": `<p>B {{ . }}</p>`,
+	})
+	cache := NewTemplateCache()
+	exec := &FSExecutor{FS: cfs, Cache: cache}
+	exec.NewViewHandler(NewView("a.html", Noop))
+	exec.NewViewHandler(NewView("b.html", Noop))
+
+	cfs.MapFS["a.html"].Data = []byte(`<p>After {{ . }}</p>`)
+	cache.Invalidate("a.html")
+
+	if _, ok := cache.Source("a.html"); ok {
+		t.Error("Expecting a.html to be removed from the cache")
+	}
+	if src, ok := cache.Source("b.html"); !ok || src != `<p>B {{ . }}</p>` {
+		t.Errorf("Expecting b.html source to remain in the cache, got %#v", src)
+	}
+
+	handler := exec.NewViewHandler(NewView("a.html", Constant("a!!")))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<p>After a!!</p>` {
+		t.Errorf("Expecting updated template to be loaded, got %s", got)
+	}
+
+	cache.Invalidate()
+	if _, ok := cache.Source("b.html"); ok {
+		t.Error("Expecting cache to be cleared")
+	}
+}
+
+func TestTemplateCache_DeveloperExecutor(t *testing.T) {
+	cfs := newCountingFS(map[string]string{
+		"test.html": `<p>Before {{ . }}</p>`,
+	})
+	dev := DeveloperExecutor{&FSExecutor{FS: cfs, Cache: NewTemplateCache()}}
+	handler := dev.NewViewHandler(NewView("test.html", Constant("from handler")))
+	if errs := dev.FlushErrors(); len(errs) != 0 {
+		t.Error("Template errors", errs)
+	}
+
+	cfs.MapFS["test.html"].Data = []byte(`<p>After {{ . }}</p>`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "*/*"))
+	if got := sDumpBody(rec); got != `<p>After from handler</p>` {
+		t.Errorf("Expecting developer executor to reload the template, got %s", got)
+	}
+}
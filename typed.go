@@ -0,0 +1,86 @@
+package treetop
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// TypedViewHandlerFunc is a view handler function with a specific type of template data,
+// see NewTypedView
+type TypedViewHandlerFunc[T any] func(Response, *http.Request) T
+
+// NewTypedView creates a view with a handler that returns data of type T.
+//
+// The view is the same as one created by NewView, but the data type is recorded so that
+// the template of the view can be checked when the handler is constructed. For each sub view,
+// the template must pass a field of T to the sub view block that can hold the sub view data.
+//
+// Example:
+//
+//	type Page struct {
+//		Content Content
+//	}
+//
+//	base := treetop.NewTypedView("base.html", func(rsp treetop.Response, req *http.Request) Page {
+//		content, _ := treetop.HandleSubViewAs[Content](rsp, "content", req)
+//		return Page{Content: content}
+//	})
+//	treetop.NewTypedSubView(base, "content", "content.html", contentHandler)
+//
+// where the base.html template includes {{ template "content" .Content }}
+func NewTypedView[T any](tmpl string, handler TypedViewHandlerFunc[T]) *View {
+	v := NewView(tmpl, handler.viewHandlerFunc())
+	v.dataType = typeOf[T]()
+	return v
+}
+
+// NewTypedSubView creates a sub view of the parent with a handler that returns data of type T.
+// This is equivalent to parent.NewSubView, if the parent is nil the sub view is detached.
+func NewTypedSubView[T any](parent *View, defines, tmpl string, handler TypedViewHandlerFunc[T]) *View {
+	var v *View
+	if parent == nil {
+		v = NewSubView(defines, tmpl, handler.viewHandlerFunc())
+	} else {
+		v = parent.NewSubView(defines, tmpl, handler.viewHandlerFunc())
+	}
+	v.dataType = typeOf[T]()
+	return v
+}
+
+// NewDefaultTypedSubView creates a sub view of the parent with a handler that returns data of
+// type T, the parent will use this sub view by default. This is equivalent to parent.NewDefaultSubView.
+//
+// The parent view is required, this will panic if the parent is nil.
+func NewDefaultTypedSubView[T any](parent *View, defines, tmpl string, handler TypedViewHandlerFunc[T]) *View {
+	if parent == nil {
+		panic("treetop: NewDefaultTypedSubView requires a parent view")
+	}
+	v := NewTypedSubView(parent, defines, tmpl, handler)
+	parent.SubViews[defines] = v
+	return v
+}
+
+// HandleSubViewAs loads data from a named sub view handler as a value of type T. The zero value
+// and false are returned if no handler is available for the name, or the data is not a T.
+//
+// A view with a data type cannot have a cache policy, since the data of a cached view is not
+// available to the parent handler. This is reported as a template error when the handler is created.
+func HandleSubViewAs[T any](rsp Response, name string, req *http.Request) (T, bool) {
+	data, ok := rsp.HandleSubView(name, req).(T)
+	return data, ok
+}
+
+// viewHandlerFunc adapts the typed handler to the ViewHandlerFunc signature
+func (f TypedViewHandlerFunc[T]) viewHandlerFunc() ViewHandlerFunc {
+	if f == nil {
+		return nil
+	}
+	return func(rsp Response, req *http.Request) interface{} {
+		return f(rsp, req)
+	}
+}
+
+// typeOf returns the reflect type for T, including interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,165 @@
+package treetop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type typedPage struct {
+	Title   string
+	Content typedContent
+	Nav     interface{}
+}
+
+type typedContent struct {
+	Message string
+}
+
+func (p typedPage) Main() typedContent {
+	return p.Content
+}
+
+func setupTypedViews(baseTemplate string) (*View, *View) {
+	base := NewTypedView(baseTemplate, func(rsp Response, req *http.Request) typedPage {
+		content, _ := HandleSubViewAs[typedContent](rsp, "content", req)
+		return typedPage{
+			Title:   "typed",
+			Content: content,
+			Nav:     rsp.HandleSubView("nav", req),
+		}
+	})
+	base.NewDefaultSubView("nav", `<nav>{{ . }}</nav>`, Constant("nav"))
+	content := NewDefaultTypedSubView(base, "content", `<p>{{ .Message }}</p>`, func(rsp Response, req *http.Request) typedContent {
+		return typedContent{Message: "Hello " + req.URL.Path}
+	})
+	return base, content
+}
+
+func TestNewTypedView(t *testing.T) {
+	_, content := setupTypedViews(`<div>{{ .Title }} {{ template "nav" .Nav }}{{ template "content" .Content }}</div>`)
+	exec := StringExecutor{}
+	handler := exec.NewViewHandler(content)
+	if errs := exec.FlushErrors(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", "text/html"))
+	expect := `<div>typed <nav>nav</nav><p>Hello /some/path</p></div>`
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, mockRequest("/some/path", TemplateContentType))
+	expect = "<template>\n<p>Hello /some/path</p>\n</template>"
+	if got := sDumpBody(rec); got != expect {
+		t.Errorf("Expecting body\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestHandleSubViewAs(t *testing.T) {
+	base := NewView("base.html", Noop)
+	base.NewDefaultSubView("text", "text.html", Constant("hello"))
+	base.NewDefaultSubView("empty", "empty.html", Noop)
+	rsp := BeginResponse(mockRequest("/", "text/html").Context(), httptest.NewRecorder()).WithSubViews(base.SubViews)
+	req := mockRequest("/", "text/html")
+
+	if got, ok := HandleSubViewAs[string](rsp, "text", req); !ok || got != "hello" {
+		t.Errorf("Expecting string data, got %q %v", got, ok)
+	}
+	if got, ok := HandleSubViewAs[int](rsp, "text", req); ok || got != 0 {
+		t.Errorf("Expecting the zero value for the wrong type, got %d %v", got, ok)
+	}
+	if _, ok := HandleSubViewAs[string](rsp, "empty", req); ok {
+		t.Error("Expecting false for nil data")
+	}
+	if _, ok := HandleSubViewAs[string](rsp, "missing", req); ok {
+		t.Error("Expecting false for a missing sub view")
+	}
+}
+
+func TestTypedView_TemplateCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expect   string
+	}{
+		{
+			name:     "variable and method",
+			template: `{{ template "nav" $.Nav }}{{ if .Title }}{{ template "content" .Main }}{{ end }}`,
+		},
+		{
+			name:     "range is not checked",
+			template: `{{ template "nav" .Nav }}{{ range .Title }}{{ template "content" .Other }}{{ end }}`,
+		},
+		{
+			name:     "missing field",
+			template: `{{ template "nav" .Nav }}{{ template "content" .Body }}`,
+			expect:   `line 1:47: treetop.typedPage has no field or method .Body`,
+		},
+		{
+			name:     "wrong type",
+			template: `{{ template "nav" .Nav }}{{ template "content" .Title }}`,
+			expect:   `sub view block "content": .Title has type string, the sub view data has type treetop.typedContent`,
+		},
+		{
+			name:     "no data",
+			template: `{{ template "nav" .Nav }}{{ template "content" }}`,
+			expect:   `sub view block "content": no data is passed to the sub view`,
+		},
+		{
+			name:     "missing untyped field",
+			template: `{{ template "nav" .Navigation.Items }}{{ template "content" .Content }}`,
+			expect:   `line 1:29: treetop.typedPage has no field or method .Navigation`,
+		},
+	}
+	for _, tt := range tests {
+		_, content := setupTypedViews(tt.template)
+		exec := StringExecutor{}
+		exec.NewViewHandler(content)
+		errs := exec.FlushErrors()
+		if tt.expect == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors %s", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) == 0 {
+			t.Errorf("%s: expecting an error", tt.name)
+			continue
+		}
+		if got := errs.Error(); !strings.Contains(got, tt.expect) {
+			t.Errorf("%s: expecting error to contain %q, got %q", tt.name, tt.expect, got)
+		}
+	}
+}
+
+func TestTypedView_CachePolicy(t *testing.T) {
+	_, content := setupTypedViews(`<div>{{ template "nav" .Nav }}{{ template "content" .Content }}</div>`)
+	content.Cache = &CachePolicy{TTL: time.Minute, Store: NewFragmentLRU(10)}
+	exec := StringExecutor{}
+	exec.NewViewHandler(content)
+	errs := exec.FlushErrors()
+	if len(errs) == 0 {
+		t.Fatal("Expecting an error for a typed view with a cache policy")
+	}
+	expect := "a view with data type treetop.typedContent cannot have a cache policy"
+	if got := errs.Error(); !strings.Contains(got, expect) {
+		t.Errorf("Expecting error to contain %q, got %q", expect, got)
+	}
+}
+
+func TestNewDefaultTypedSubView_NilParent(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expecting a panic for a nil parent")
+		}
+	}()
+	NewDefaultTypedSubView(nil, "content", "content.html", func(rsp Response, req *http.Request) string {
+		return ""
+	})
+}
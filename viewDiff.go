@@ -0,0 +1,195 @@
+package treetop
+
+import (
+	"sort"
+	"strings"
+)
+
+// ViewChangeKind describes a difference between two view hierarchies, see DiffViews
+type ViewChangeKind string
+
+const (
+	// SubViewAdded is a sub view block that is only present in the second hierarchy
+	SubViewAdded ViewChangeKind = "added"
+	// SubViewRemoved is a sub view block that is only present in the first hierarchy
+	SubViewRemoved ViewChangeKind = "removed"
+	// SubViewChanged is a sub view block present in both hierarchies, but only one
+	// has a view for the block
+	SubViewChanged ViewChangeKind = "changed"
+	// TemplateChanged is a view with a different template in each hierarchy
+	TemplateChanged ViewChangeKind = "template"
+	// HandlerChanged is a view with a different handler function in each hierarchy
+	HandlerChanged ViewChangeKind = "handler"
+)
+
+// ViewChange is a single difference between two view hierarchies
+type ViewChange struct {
+	Kind ViewChangeKind
+	// Path is the list of sub view block names from the root to the view, empty for the root
+	Path []string
+	// A and B are the views of each hierarchy, one will be nil if the block was added or removed
+	A, B *View
+}
+
+// ViewDiff is the structural difference between two view hierarchies
+type ViewDiff struct {
+	A, B    *View
+	Changes []ViewChange
+}
+
+// DiffViews compares two view hierarchies. Sub view blocks are matched by name, blocks that are
+// added, removed or that have a view in only one hierarchy are reported along with views that have
+// a different template or handler. The descendants of an added or removed block are not reported
+// individually.
+//
+// Handlers are compared by function name, closures created by the same function are equal.
+//
+// Example, the differences between page and fragment views of an endpoint
+//
+//	page, part, _ := treetop.CompileViews(content)
+//	fmt.Println(treetop.DiffViews(page, part))
+func DiffViews(a, b *View) *ViewDiff {
+	diff := &ViewDiff{A: a, B: b}
+	diff.compare(nil, a, b)
+	return diff
+}
+
+// compare records the changes between a pair of views and their sub views
+func (d *ViewDiff) compare(path []string, a, b *View) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil || b == nil:
+		d.add(SubViewChanged, path, a, b)
+		return
+	}
+	if a.Template != b.Template {
+		d.add(TemplateChanged, path, a, b)
+	}
+	if handlerName(a) != handlerName(b) {
+		d.add(HandlerChanged, path, a, b)
+	}
+	for _, name := range subViewNames(a.SubViews, b.SubViews) {
+		subA, inA := a.SubViews[name]
+		subB, inB := b.SubViews[name]
+		subPath := append(path[:len(path):len(path)], name)
+		switch {
+		case !inA:
+			d.add(SubViewAdded, subPath, nil, subB)
+		case !inB:
+			d.add(SubViewRemoved, subPath, subA, nil)
+		default:
+			d.compare(subPath, subA, subB)
+		}
+	}
+}
+
+// add records a change
+func (d *ViewDiff) add(kind ViewChangeKind, path []string, a, b *View) {
+	d.Changes = append(d.Changes, ViewChange{Kind: kind, Path: path, A: a, B: b})
+}
+
+// Equal is true if no differences were found
+func (d *ViewDiff) Equal() bool {
+	return len(d.Changes) == 0
+}
+
+// String creates a report of the differences in the tree format of SprintViewTree.
+// Each view of both hierarchies is listed with a marker for the change, '+' for added,
+// '-' for removed and '~' for a view that differs between the hierarchies. The view
+// of the first hierarchy is followed by '=>' and the view of the second.
+//
+// For example
+//
+//   - View("base.html", github.com/rur/treetop.Constant.func1)
+//     |- A: ~ SubView("A", "A.html", github.com/rur/treetop.Constant.func1) => SubView("A", "A2.html", github.com/rur/treetop.Constant.func1)
+//     |  '- A1: - SubView("A1", "A1.html", github.com/rur/treetop.Constant.func1)
+//     |
+//     '- B: + SubView("B", "B.html", github.com/rur/treetop.Constant.func1)
+func (d *ViewDiff) String() string {
+	str := strings.Builder{}
+	str.WriteString("- ")
+	str.WriteString(sprintViewDiffInfo(d.A, d.B, true, true))
+	var subA, subB map[string]*View
+	if d.A != nil {
+		subA = d.A.SubViews
+	}
+	if d.B != nil {
+		subB = d.B.SubViews
+	}
+	fprintViewDiff(&str, []byte("  "), subA, subB)
+	return str.String()
+}
+
+// sprintViewDiffInfo previews a pair of views with a change marker, inA and inB
+// indicate if the block exists in each hierarchy
+func sprintViewDiffInfo(a, b *View, inA, inB bool) string {
+	switch {
+	case !inA:
+		return "+ " + SprintViewInfo(b)
+	case !inB:
+		return "- " + SprintViewInfo(a)
+	case a == nil && b == nil:
+		return SprintViewInfo(nil)
+	case a == nil || b == nil || a.Template != b.Template || handlerName(a) != handlerName(b):
+		return "~ " + SprintViewInfo(a) + " => " + SprintViewInfo(b)
+	}
+	return SprintViewInfo(b)
+}
+
+// fprintViewDiff writes the sub views of both hierarchies in the format of fprintViewTree,
+// a sub view that is only present in one hierarchy is written with its descendants
+func fprintViewDiff(w *strings.Builder, prefix []byte, viewsA, viewsB map[string]*View) {
+	keys := subViewNames(viewsA, viewsB)
+	for i, k := range keys {
+		last := i == len(keys)-1
+		subA, inA := viewsA[k]
+		subB, inB := viewsB[k]
+		w.Write(append([]byte{'\n'}, prefix...))
+		if last {
+			w.WriteString("'- " + k + ": " + sprintViewDiffInfo(subA, subB, inA, inB))
+		} else {
+			w.WriteString("|- " + k + ": " + sprintViewDiffInfo(subA, subB, inA, inB))
+		}
+		var subViewsA, subViewsB map[string]*View
+		if subA != nil {
+			subViewsA = subA.SubViews
+		}
+		if subB != nil {
+			subViewsB = subB.SubViews
+		}
+		if len(subViewsA) > 0 || len(subViewsB) > 0 {
+			var subPrefix []byte
+			if last {
+				subPrefix = append(prefix, []byte("   ")...)
+			} else {
+				subPrefix = append(prefix, []byte("|  ")...)
+			}
+			fprintViewDiff(w, subPrefix, subViewsA, subViewsB)
+		} else if last {
+			// add padding to mark end of a branch, without trailing spaces
+			for j := len(prefix) - 1; j > -1; j-- {
+				if prefix[j] != ' ' {
+					w.WriteString("\n")
+					w.Write(prefix[:j+1])
+					break
+				}
+			}
+		}
+	}
+}
+
+// subViewNames returns the sorted union of block names of both sets of sub views
+func subViewNames(viewsA, viewsB map[string]*View) []string {
+	var names []string
+	for name := range viewsA {
+		names = append(names, name)
+	}
+	for name := range viewsB {
+		if _, ok := viewsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
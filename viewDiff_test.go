@@ -0,0 +1,87 @@
+package treetop
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func setupDiffViews() (*View, *View) {
+	a := NewView("base.html", Constant("base!"))
+	aA := a.NewDefaultSubView("A", "A.html", Constant("A!"))
+	aA.NewDefaultSubView("A1", "A1.html", Constant("A1!"))
+	a.NewDefaultSubView("B", "B.html", Constant("B!"))
+	a.NewSubView("C", "C.html", Constant("C!"))
+
+	b := NewView("base.html", Constant("base!"))
+	bA := b.NewDefaultSubView("A", "A2.html", Constant("A!"))
+	bA.NewDefaultSubView("A1", "A1.html", Noop)
+	b.NewSubView("B", "B.html", Constant("B!"))
+	b.NewDefaultSubView("C", "C.html", Constant("C!"))
+	b.NewDefaultSubView("D", "D.html", Constant("D!"))
+	return a, b
+}
+
+func TestDiffViews(t *testing.T) {
+	a, b := setupDiffViews()
+	diff := DiffViews(a, b)
+	got := make([]string, len(diff.Changes))
+	for i, change := range diff.Changes {
+		got[i] = string(change.Kind) + " " + strings.Join(change.Path, "/")
+	}
+	expect := []string{
+		"template A",
+		"handler A/A1",
+		"changed B",
+		"changed C",
+		"added D",
+	}
+	if strings.Join(got, ", ") != strings.Join(expect, ", ") {
+		t.Errorf("Expecting changes %v, got %v", expect, got)
+	}
+	if diff.Equal() {
+		t.Error("Expecting views not to be equal")
+	}
+	if changes := DiffViews(b, a).Changes; changes[len(changes)-1].Kind != SubViewRemoved {
+		t.Errorf("Expecting a removed sub view, got %v", changes[len(changes)-1].Kind)
+	}
+	if diff := DiffViews(a, a.Copy()); !diff.Equal() {
+		t.Errorf("Expecting a copy to be equal, got %v", diff.Changes)
+	}
+}
+
+func TestDiffViews_String(t *testing.T) {
+	a, b := setupDiffViews()
+	got := DiffViews(a, b).String()
+	expect := stripIndent(`
+		- View("base.html", github.com/rur/treetop.Constant.func1)
+		  |- A: ~ SubView("A", "A.html", github.com/rur/treetop.Constant.func1) => SubView("A", "A2.html", github.com/rur/treetop.Constant.func1)
+		  |  '- A1: ~ SubView("A1", "A1.html", github.com/rur/treetop.Constant.func1) => SubView("A1", "A1.html", github.com/rur/treetop.Noop)
+		  |
+		  |- B: ~ SubView("B", "B.html", github.com/rur/treetop.Constant.func1) => nil
+		  |- C: ~ nil => SubView("C", "C.html", github.com/rur/treetop.Constant.func1)
+		  '- D: + SubView("D", "D.html", github.com/rur/treetop.Constant.func1)
+	`)
+	if stripIndent(got) != expect {
+		t.Errorf("Expecting report\n%s\nGOT\n%s", expect, got)
+	}
+}
+
+func TestDiffViews_CompiledViews(t *testing.T) {
+	base := NewView("base.html", Noop)
+	content := base.NewSubView("content", "content.html", func(rsp Response, req *http.Request) interface{} {
+		return nil
+	})
+	content.NewDefaultSubView("nav", "nav.html", Noop)
+	page, part, _ := CompileViews(content)
+
+	diff := DiffViews(page, part)
+	got := make([]string, len(diff.Changes))
+	for i, change := range diff.Changes {
+		got[i] = string(change.Kind) + " " + strings.Join(change.Path, "/")
+	}
+	expect := []string{"template ", "handler ", "removed content", "added nav"}
+	if strings.Join(got, ", ") != strings.Join(expect, ", ") {
+		t.Errorf("Expecting changes %v, got %v", expect, got)
+	}
+}
@@ -1,5 +1,7 @@
 package treetop
 
+import "reflect"
+
 // View is used to define hierarchies of nested template-handler pairs
 // so that HTTP endpoints can be constructed for different page configurations.
 //
@@ -60,12 +62,32 @@ package treetop
 // This is useful for creating Treetop enabled endpoints because the constructed handler
 // is capable of loading either a full page or just the "content" part of the page depending
 // upon the request.
+//
+// An ErrorTemplate can be specified to act as an error boundary for a view. If the template
+// of the view, or of any view nested within it, fails to execute, the error template will be
+// rendered in its place with a *ViewError as data. The same applies when one of the handlers
+// panics, the *ViewError will wrap the *HandlerPanic. The rest of the page or fragment will
+// render as normal, with an internal server error response status.
+//
+// A sub view with Stream enabled does not hold up the part of a streamed page that precedes
+// its block, the block is sent once the handler of the view completes, see TemplateHandler.StreamPage.
+//
+// A Cache policy can be specified for a sub view so that the rendered HTML is reused
+// between requests, see CachePolicy. HTTP caching intent is declared using CacheControl,
+// the directives of all views in a response are combined.
 type View struct {
-	Template    string
-	HandlerFunc ViewHandlerFunc
-	SubViews    map[string]*View
-	Defines     string
-	Parent      *View
+	Template      string
+	HandlerFunc   ViewHandlerFunc
+	SubViews      map[string]*View
+	Defines       string
+	Parent        *View
+	ErrorTemplate string
+	Cache         *CachePolicy
+	CacheControl  *CacheControl
+	Stream        bool
+
+	// type of the handler data, for views created with NewTypedView
+	dataType reflect.Type
 }
 
 // NewView creates an instance of a view given a template + handler pair
@@ -120,6 +142,11 @@ func (v *View) Copy() *View {
 	copy := NewView(v.Template, v.HandlerFunc)
 	copy.Defines = v.Defines
 	copy.Parent = v.Parent
+	copy.ErrorTemplate = v.ErrorTemplate
+	copy.Cache = v.Cache
+	copy.CacheControl = v.CacheControl
+	copy.Stream = v.Stream
+	copy.dataType = v.dataType
 	for name, sub := range v.SubViews {
 		copy.SubViews[name] = sub.Copy()
 	}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"unicode/utf8"
 )
 
@@ -76,7 +75,7 @@ func (tw *writer) WriteHeader(status int) {
 			pageURL = respURI.String()
 		}
 		header.Set("X-Page-URL", hexEscapeNonASCII(pageURL))
-		header.Add("Vary", "Accept")
+		addVary(header, "Accept")
 		if tw.replaceURLState {
 			header.Set("X-Response-History", "replace")
 		}
@@ -126,7 +125,7 @@ func NewPartialWriter(w http.ResponseWriter, req *http.Request) (Writer, bool) {
 	return ttW, ok
 }
 
-// NewFragmentWriter will check if the client accepts one of the Treetop content types,
+// NewFragmentWriter will check if the client accepts one of the Treetop content types, see IsTemplateRequest.
 // if so it will return a wrapped response writer for a Treetop html fragment.
 //
 // Example:
@@ -140,16 +139,12 @@ func NewPartialWriter(w http.ResponseWriter, req *http.Request) (Writer, bool) {
 //		/* otherwise handle request in a different way (unspecified) */
 //	}
 func NewFragmentWriter(w http.ResponseWriter, req *http.Request) (Writer, bool) {
-	var ttW *writer
-	for _, accept := range strings.Split(req.Header.Get("Accept"), ";") {
-		if strings.ToLower(strings.TrimSpace(accept)) == TemplateContentType {
-			ttW = &writer{
-				ResponseWriter: w,
-			}
-			break
-		}
+	if !IsTemplateRequest(req) {
+		return nil, false
 	}
-	return ttW, (ttW != nil)
+	return &writer{
+		ResponseWriter: w,
+	}, true
 }
 
 // lifted from go http internals, escape parameterized header values to be ASCII